@@ -0,0 +1,191 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ackermannd/clifmt"
+	"github.com/aryann/difflib"
+)
+
+// diffContext is the number of unchanged lines around each hunk of a unified diff
+const diffContext = 3
+
+// noEOLMark is appended to a last line without newline while diffing
+const noEOLMark = "\x00"
+
+// printChanges prints the lines which differ between orig and changed in the
+// format chosen by --diff-format
+func printChanges(path, orig, changed string) {
+	if diffFormat == "unified" {
+		fmt.Print(unifiedDiff(patchPath(path), orig, changed))
+		return
+	}
+	diff := difflib.Diff(strings.Split(orig, "\n"), strings.Split(changed, "\n"))
+	fmt.Println("Changes: ")
+	for _, val := range diff {
+		switch val.Delta.String() {
+		case " ":
+			continue
+		case "-":
+			clifmt.Settings.Color = clifmt.Red
+		case "+":
+			clifmt.Settings.Color = clifmt.Green
+		}
+		clifmt.Println(val)
+	}
+	clifmt.Settings.Color = ""
+}
+
+// notices returns where messages besides the changes are printed, with
+// --diff-format=unified stdout only gets the patch
+func notices() io.Writer {
+	if diffFormat == "unified" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printWarning prints msg in red, or plain on stderr while printing a patch
+func printWarning(msg string) {
+	if diffFormat == "unified" {
+		fmt.Fprintln(os.Stderr, msg)
+		return
+	}
+	clifmt.Settings.Color = clifmt.Red
+	clifmt.Println(msg)
+	clifmt.Settings.Color = ""
+}
+
+// patchPath returns path relative to the project directory, the folder of the
+// first compose file, which is where a unified diff has to be applied
+func patchPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	root, err := filepath.Abs(filepath.Dir(composeFiles[0]))
+	if err == nil {
+		if rel, err := filepath.Rel(root, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s is outside of the project directory %s, its patch has to be applied from /\n", path, root)
+	return strings.TrimPrefix(filepath.ToSlash(abs), "/")
+}
+
+// unifiedDiff returns the changes between orig and changed as a patch for
+// name, which can be applied with git apply or patch -p1
+func unifiedDiff(name, orig, changed string) string {
+	if orig == changed {
+		return ""
+	}
+	a, aNoEOL := splitLines(orig)
+	b, bNoEOL := splitLines(changed)
+	// a last line which only one side ends with a newline differs, it has
+	// to be removed and added again instead of being context
+	if aNoEOL != bNoEOL {
+		if aNoEOL {
+			a[len(a)-1] += noEOLMark
+		}
+		if bNoEOL {
+			b[len(b)-1] += noEOLMark
+		}
+	}
+	diff := difflib.Diff(a, b)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+
+	// aPos and bPos count the lines of each file before record i
+	aPos := make([]int, len(diff)+1)
+	bPos := make([]int, len(diff)+1)
+	for i, rec := range diff {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if rec.Delta != difflib.RightOnly {
+			aPos[i+1]++
+		}
+		if rec.Delta != difflib.LeftOnly {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(diff); i++ {
+		if diff[i].Delta == difflib.Common {
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk as long as the next change is close enough
+		end, common := i, 0
+		for j := i; j < len(diff) && common <= 2*diffContext; j++ {
+			if diff[j].Delta == difflib.Common {
+				common++
+				continue
+			}
+			end, common = j, 0
+		}
+		stop := end + diffContext + 1
+		if stop > len(diff) {
+			stop = len(diff)
+		}
+
+		aCount, bCount := aPos[stop]-aPos[start], bPos[stop]-bPos[start]
+		aStart, bStart := aPos[start]+1, bPos[start]+1
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for j := start; j < stop; j++ {
+			out.WriteString(diff[j].Delta.String() + strings.TrimSuffix(diff[j].Payload, noEOLMark) + "\n")
+			lastA := diff[j].Delta != difflib.RightOnly && aPos[j+1] == len(a) && aNoEOL
+			lastB := diff[j].Delta != difflib.LeftOnly && bPos[j+1] == len(b) && bNoEOL
+			if lastA || lastB {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = stop - 1
+	}
+	return out.String()
+}
+
+// splitLines splits content into lines and reports if the final newline is missing
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return []string{}, false
+	}
+	lines := strings.Split(content, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1], false
+	}
+	return lines, true
+}
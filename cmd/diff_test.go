@@ -0,0 +1,131 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lines returns the numbers from to to as lines of a file
+func lines(from, to int) string {
+	s := ""
+	for i := from; i <= to; i++ {
+		s += fmt.Sprintf("%d\n", i)
+	}
+	return s
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	cases := []struct {
+		name    string
+		orig    string
+		changed string
+		want    string
+		hunks   int
+	}{
+		{"unchanged", lines(1, 3), lines(1, 3), "", 0},
+		{"middle", lines(1, 10), strings.Replace(lines(1, 10), "5\n", "five\n", 1),
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n", 1},
+		{"first line", lines(1, 5), "zero\n" + lines(1, 5),
+			"@@ -1,3 +1,4 @@\n+zero\n 1\n 2\n 3\n", 1},
+		{"adjacent hunks", lines(1, 10), strings.NewReplacer("2\n", "two\n", "9\n", "nine\n").Replace(lines(1, 10)), "", 1},
+		{"separate hunks", lines(1, 20), strings.NewReplacer("2\n", "two\n", "19\n", "nineteen\n").Replace(lines(1, 20)), "", 2},
+		{"empty before", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n", 1},
+		{"empty after", "a\nb\n", "", "@@ -1,2 +0,0 @@\n-a\n-b\n", 1},
+		{"newline added", "a\nb", "a\nb\n",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n", 1},
+		{"newline removed", "a\nb\n", "a\nb",
+			"@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n", 1},
+		{"no newline on both", "a\nb", "a\nc",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n", 1},
+		{"context without newline", "a\nb\nc", "x\nb\nc",
+			"@@ -1,3 +1,3 @@\n-a\n+x\n b\n c\n\\ No newline at end of file\n", 1},
+	}
+	_, gitErr := exec.LookPath("git")
+	for _, c := range cases {
+		got := unifiedDiff("docker-compose.yml", c.orig, c.changed)
+		if c.want != "" || c.orig == c.changed {
+			want := c.want
+			if want != "" {
+				want = "--- a/docker-compose.yml\n+++ b/docker-compose.yml\n" + want
+			}
+			if got != want {
+				t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, want)
+			}
+		}
+		if n := strings.Count(got, "\n@@ "); n != c.hunks {
+			t.Errorf("%s: got %d hunks, want %d:\n%s", c.name, n, c.hunks, got)
+		}
+		if got == "" || gitErr != nil {
+			continue
+		}
+		if applied, err := gitApply(c.orig, got); err != nil {
+			t.Errorf("%s: git apply: %s\n%s", c.name, err, got)
+		} else if applied != c.changed {
+			t.Errorf("%s: git apply resulted in %q, want %q", c.name, applied, c.changed)
+		}
+	}
+}
+
+// gitApply applies patch to a docker-compose.yml containing orig and
+// returns the result
+func gitApply(orig, patch string) (string, error) {
+	dir, err := ioutil.TempDir("", "cft")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(path, []byte(orig), 0644); err != nil {
+		return "", err
+	}
+	for _, args := range [][]string{{"apply", "--check"}, {"apply"}} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(patch)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s: %s", err, out)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	return string(data), err
+}
+
+func TestPatchPath(t *testing.T) {
+	defer func(files []string) { composeFiles = files }(composeFiles)
+	composeFiles = []string{filepath.Join("..", "stack", "docker-compose.yml")}
+	cases := map[string]string{
+		filepath.Join("..", "stack", "docker-compose.yml"):          "docker-compose.yml",
+		filepath.Join("..", "stack", "docker-compose.override.yml"): "docker-compose.override.yml",
+		filepath.Join("..", "stack", "env", "prod.env"):             "env/prod.env",
+	}
+	for path, want := range cases {
+		if got := patchPath(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
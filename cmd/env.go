@@ -0,0 +1,57 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Lists the variables used in the compose files",
+	Long:  `Lists all variables referenced in the compose files with the value they resolve to and where it comes from: the environment, the env file, the default given in the compose file, or unset. Like docker-compose the environment wins over the env file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+
+		vars := project.Variables()
+		return printOutput(vars, func() error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "VARIABLE\tVALUE\tSOURCE")
+			for _, v := range vars {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, v.Value, v.Source)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(envCmd)
+	envCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format, either table, json or yaml")
+}
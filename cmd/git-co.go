@@ -22,178 +22,672 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
-	"github.com/ackermannd/clifmt"
+	"github.com/ackermannd/cft/compose"
+	"github.com/ackermannd/cft/git"
 	"github.com/spf13/cobra"
 )
 
 var branch string
 var remoteOnly bool
+var rewriteRemote bool
+var jobs int
+var base string
+var noCreate bool
+var untracked bool
+var back bool
+var onDirty string
+var remotes []string
+var gitBackendName string
+
+// backend runs the git operations of git-co and stashes
+var backend git.Backend
+
+// Results of a repository in the git-co summary
+const (
+	resultTracking = "tracking %s"
+	resultCreated  = "created from %s"
+	resultSkipped  = "skipped"
+	resultFailed   = "failed"
+	resultBack     = "back on %s"
+)
+
+// repo is a repository git-co works on. Services building from the same
+// repository share it, so it is only fetched and checked out once.
+type repo struct {
+	folder   string
+	services []string
+	// base is the ref new branches start from, detected from the HEAD of
+	// the remote if empty
+	base string
+	// remotes are searched for the branch in this order, remote is the one
+	// it was found on
+	remotes []string
+	remote  string
+	// out collects the output, it is printed as one block once the
+	// repository is done
+	out bytes.Buffer
+
+	state    string
+	previous string
+	current  string
+	stashed  bool
+	result   string
+	err      error
+
+	// record is what git-co did, changed is set if the branch was changed
+	record  *checkoutRecord
+	changed bool
+}
+
+// checkoutRecord remembers a checkout of git-co in a repository, so --back
+// can return to the previous branch and restore the stash
+type checkoutRecord struct {
+	Previous string `json:"previous"`
+	Branch   string `json:"branch"`
+	// Stash is the message of the stash holding the local changes
+	Stash string `json:"stash,omitempty"`
+}
 
 // gitCoCmd represents the git-co command
 var gitCoCmd = &cobra.Command{
 	Use:   "git-co <service name> [<service name> <service name> ...]",
 	Short: "Checkout specific branches for the given services",
-	Long:  `Takes information from Buildpaths of the given services and checks out the given branch. If local changes are represent, they'll be stashed`,
+	Long:  `Takes information from Buildpaths of the given services and checks out the given branch. If local changes are represent, they'll be stashed with a message naming the services, see cft stashes. --back returns to the previous branches and restores the stashes. Before anything is changed the state of every repository is checked, repositories in the middle of a rebase, merge or cherry-pick are left alone and a detached HEAD with local changes counts as dirty, see --on-dirty. With --jobs several repositories are processed at once, repositories shared by multiple services are only checked out once. A summary of all services is printed at the end.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := checkComposeFile()
-		if err != nil {
-			return err
-		}
-		if branch == "" {
+		if branch == "" && !back {
 			return errors.New("No branch name given")
 		}
+		if branch != "" && back {
+			return errors.New("--back returns to the previous branches, no branch can be given")
+		}
+		if onDirty != "stash" && onDirty != "skip" && onDirty != "fail" {
+			return errors.New("Unknown --on-dirty " + onDirty + ", use stash, skip or fail")
+		}
+		if jobs < 1 {
+			return errors.New("--jobs has to be at least 1")
+		}
 
-		cf, err := os.Open(composeFile)
+		project, err := loadProject()
 		if err != nil {
 			return err
 		}
-		defer cf.Close()
+		if err := loadGitBackend(); err != nil {
+			return err
+		}
 		if len(args) == 0 {
 			if force == false {
 				if !confirm("No service name given, this will iterate through all services and tries to check out the remote branch if it exists. Continue? [y/n]") {
 					os.Exit(0)
 				}
 			}
-			tmpComposeFolder, _ := filepath.Abs(composeFile)
-			tmpComposeFolder = filepath.Dir(tmpComposeFolder)
-			cmd := exec.Command("docker-compose", "config", "--services")
-			cmd.Dir = tmpComposeFolder
-			tmp, _ := cmd.Output()
-			args = strings.Split(string(tmp), "\n")
-			args = args[0 : len(args)-1]
-		}
-
-		cfd, _ := ioutil.ReadAll(cf)
-		origData := string(cfd)
-		clifmt.Settings.Intendation = " "
-		for _, sv := range args {
-			service := extractService(sv, origData)
-
-			checkReg := regexp.MustCompile("build:(.*)")
-			folder := strings.TrimSpace(checkReg.ReplaceAllString(checkReg.FindString(service), "$1"))
-
-			if _, err := os.Stat(folder); err != nil && os.IsNotExist(err) {
-				fmt.Println("folder does not exists: " + folder)
-				continue
-			}
-
-			fmt.Println("Working in  " + folder)
+			args = project.ServiceNames()
+		}
 
-			clifmt.Println("Checking if remote origin exists")
-			_, stderr, err := execCmd(folder, "git", "remote", "show", "origin")
-			if err != nil && err.Error() != "exit status 128" {
-				return errors.New(err.Error() + ": " + stderr.String())
+		skipped := map[string]string{}
+		if rewriteRemote && !back {
+			skipped = rewriteRemoteContexts(project, args)
+		}
+		repos, reasons, err := serviceRepos(project, args)
+		if err != nil {
+			return err
+		}
+		for sv, reason := range reasons {
+			if _, ok := skipped[sv]; !ok {
+				skipped[sv] = reason
 			}
-			if err != nil && err.Error() == "exit status 128" {
-				if remoteOnly {
-					clifmt.Println("No remote origin available")
-					continue
-				}
-				clifmt.Println("No remote origin available, creating local branch")
-				clifmt.Println(fmt.Sprintf("Stashing changes in %s", folder))
-				_, stderr, err := execCmd(folder, "git", "stash")
-				if err != nil {
-					return errors.New(err.Error() + ": " + stderr.String())
-				}
-
-				stdout, stderr, err := execCmd(folder, "git", "checkout", "-B", branch)
+		}
 
-				if err != nil {
-					return errors.New(err.Error() + ": " + stderr.String())
-				}
-				if stdout.String() != "" {
-					clifmt.Println(strings.Replace(stdout.String(), "\n", "\n    ", -1))
-				}
+		if err := preflight(repos); err != nil {
+			return err
+		}
+		ready := []*repo{}
+		for _, r := range repos {
+			if r.err == nil && r.result == "" {
+				ready = append(ready, r)
+			}
+		}
 
-				if stderr.String() != "" {
-					clifmt.Println(strings.Replace(stderr.String(), "\n", "\n    ", -1))
+		records, err := loadCheckouts()
+		if err != nil {
+			return err
+		}
+		if back {
+			for _, r := range ready {
+				if stack := records[r.folder]; len(stack) > 0 {
+					r.record = &stack[len(stack)-1]
 				}
-				continue
 			}
+			runJobs(ready, jobs, goBack)
+		} else {
+			runJobs(ready, jobs, checkoutBranch)
+		}
+		for _, r := range repos {
+			switch {
+			case !r.changed:
+			case back:
+				records[r.folder] = records[r.folder][:len(records[r.folder])-1]
+			default:
+				records[r.folder] = append(records[r.folder], *r.record)
+			}
+		}
+		if !dryRun {
+			if err := saveCheckouts(records); err != nil {
+				return err
+			}
+		}
 
-			clifmt.Println("Fetching remote")
-			stdout, stderr, err := execCmd(folder, "git", "fetch", "--all")
-			if err != nil {
-				return errors.New(err.Error() + ": " + stderr.String())
+		failed := printSummary(args, repos, skipped)
+		if len(project.Changed()) > 0 {
+			if err := saveProject(project); err != nil {
+				return err
 			}
-			clifmt.Println("Checking if branch exists in remote")
-			stdout, stderr, err = execCmd(folder, "git", "ls-remote", "--heads", "--exit-code", "origin", branch)
-			if err != nil {
-				if err.Error() != "exit status 2" {
-					return errors.New(err.Error() + ": " + stderr.String())
-				}
-				if remoteOnly {
-					clifmt.Println("Branch not available on remote")
-					continue
-				}
-				clifmt.Println("Branch not available on remote, switchting to local branch")
-				clifmt.Println(fmt.Sprintf("Stashing changes in %s", folder))
-				_, stderr, err = execCmd(folder, "git", "stash")
-				if err != nil {
-					return errors.New(err.Error() + ": " + stderr.String())
-				}
+		}
+		if failed > 0 && back {
+			return fmt.Errorf("Couldn't go back for %d service(s)", failed)
+		}
+		if failed > 0 {
+			return fmt.Errorf("Couldn't check out %s for %d service(s)", branch, failed)
+		}
+		return nil
+	},
+}
 
-				stdout, stderr, err = execCmd(folder, "git", "checkout", "-B", branch, "develop")
-				if err != nil {
-					return errors.New(err.Error() + ": " + stderr.String())
-				}
-				if stdout.String() != "" {
-					clifmt.Println(strings.Replace(stdout.String(), "\n", "\n    ", -1))
+// rewriteRemoteContexts points the git url build contexts of the services
+// to the branch. The services are returned with the reason why they are
+// skipped afterwards.
+func rewriteRemoteContexts(project *compose.Project, services []string) map[string]string {
+	skipped := map[string]string{}
+	for _, sv := range services {
+		info, err := project.Info(sv)
+		if err != nil || !info.Remote {
+			continue
+		}
+		service, n, err := project.ContextNode(sv)
+		if err != nil {
+			skipped[sv] = err.Error()
+			continue
+		}
+		// the written value may hold variables, only its fragment changes
+		g, ok := compose.ParseGitContext(n.Value)
+		if !ok {
+			skipped[sv] = "remote context set by a variable"
+			continue
+		}
+		g.Ref = branch
+		service.Doc.SetValue(n, g.String())
+		skipped[sv] = "remote context rewritten"
+	}
+	return skipped
+}
+
+// remoteContext is the reason services built from a git url are skipped
+const remoteContext = "remote build context"
+
+// buildRepos groups the build folders of the services by the repository
+// they are in. Services without a local build folder are returned with the
+// reason.
+func buildRepos(project *compose.Project, services []string) ([]*repo, map[string]string) {
+	skipped := map[string]string{}
+	repos := []*repo{}
+	byRoot := map[string]*repo{}
+	for _, sv := range services {
+		folder, err := project.BuildContext(sv)
+		if err != nil {
+			skipped[sv] = err.Error()
+			continue
+		}
+		if folder == "" {
+			skipped[sv] = "no build definition"
+			continue
+		}
+		if _, ok := compose.ParseGitContext(folder); ok {
+			skipped[sv] = remoteContext
+			continue
+		}
+		if _, err := os.Stat(folder); err != nil {
+			skipped[sv] = "folder does not exist: " + folder
+			continue
+		}
+		root := repoRoot(folder)
+		if r, ok := byRoot[root]; ok {
+			r.services = append(r.services, sv)
+			continue
+		}
+		r := &repo{folder: root, services: []string{sv}}
+		byRoot[root] = r
+		repos = append(repos, r)
+	}
+	return repos, skipped
+}
+
+// serviceRepos returns the repositories git-co works on with their base and
+// remotes. Services which can't be checked out are returned with the reason.
+func serviceRepos(project *compose.Project, services []string) ([]*repo, map[string]string, error) {
+	repos, skipped := buildRepos(project, services)
+	for sv, reason := range skipped {
+		if reason == remoteContext {
+			skipped[sv] = reason + ", use --rewrite-remote"
+		}
+	}
+	for _, r := range repos {
+		shared := r.services
+		r.services = nil
+		for _, sv := range shared {
+			svBase := base
+			if svBase == "" {
+				var err error
+				if svBase, err = configString("bases." + sv); err != nil {
+					return nil, nil, err
 				}
-				if stderr.String() != "" {
-					clifmt.Println(strings.Replace(stderr.String(), "\n", "\n    ", -1))
+			}
+			if len(r.services) == 0 {
+				// services sharing a repository use the remotes of the first one
+				remotes, err := serviceRemotes(sv)
+				if err != nil {
+					return nil, nil, err
 				}
+				r.services, r.base, r.remotes = []string{sv}, svBase, remotes
 				continue
 			}
-			clifmt.Println("Checking out branch origin/" + branch)
-			clifmt.Println(fmt.Sprintf("Stashing changes in %s", folder))
-			_, stderr, err = execCmd(folder, "git", "stash")
-			if err != nil {
-				return errors.New(err.Error() + ": " + stderr.String())
+			if r.base != svBase {
+				skipped[sv] = fmt.Sprintf("base %s differs from %s of %s in the same repository", svBase, r.base, r.services[0])
+				continue
 			}
+			r.services = append(r.services, sv)
+		}
+	}
+	return repos, skipped, nil
+}
 
-			stdout, stderr, err = execCmd(folder, "git", "checkout", "-B", branch, "--track", fmt.Sprintf("origin/%s", branch))
+// serviceRemotes returns the remotes searched for the branch of a service:
+// --remote, remotes.<service> or remote-order of the config, or origin
+func serviceRemotes(sv string) ([]string, error) {
+	if len(remotes) > 0 {
+		return remotes, nil
+	}
+	for _, key := range []string{"remotes." + sv, "remote-order"} {
+		list, err := configStrings(key)
+		if err != nil || len(list) > 0 {
+			return list, err
+		}
+	}
+	return []string{"origin"}, nil
+}
 
-			if err != nil {
-				return errors.New(err.Error() + ": " + stderr.String())
-			}
-			if stdout.String() != "" {
-				clifmt.Println(strings.Replace(stdout.String(), "\n", "\n    ", -1))
-			}
+// printSummary prints a table of all services and returns how many failed
+func printSummary(services []string, repos []*repo, skipped map[string]string) int {
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tFOLDER\tPREVIOUS\tBRANCH\tREMOTE\tSTASHED\tRESULT")
+	for _, sv := range services {
+		if reason, ok := skipped[sv]; ok {
+			fmt.Fprintf(w, "%s\t\t\t\t\t\t%s: %s\n", sv, resultSkipped, reason)
+			continue
+		}
+		r := repoOf(repos, sv)
+		stashed, result := "no", r.result
+		if r.stashed {
+			stashed = "yes"
+		}
+		if r.err != nil {
+			result = resultFailed + ": " + r.err.Error()
+			failed++
+		}
+		remote := r.remote
+		if remote == "" {
+			remote = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", sv, r.folder, r.previous, r.current, remote, stashed, result)
+	}
+	fmt.Println()
+	w.Flush()
+	return failed
+}
 
-			if stderr.String() != "" {
-				clifmt.Println(strings.Replace(stderr.String(), "\n", "\n    ", -1))
+// runJobs calls fn for all repositories with at most n running at once. The
+// output of each repository is printed as soon as it is done.
+func runJobs(repos []*repo, n int, fn func(*repo)) {
+	queue := make(chan *repo)
+	var print sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < n && i < len(repos); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				fn(r)
+				print.Lock()
+				fmt.Printf("Working in %s (%s)\n", r.folder, strings.Join(r.services, ", "))
+				os.Stdout.Write(r.out.Bytes())
+				print.Unlock()
 			}
+		}()
+	}
+	for _, r := range repos {
+		queue <- r
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// checkoutBranch checks out the branch in r, tracking it on the first
+// remote of the search list which has it
+func checkoutBranch(r *repo) {
+	r.current = branch
+	r.record = &checkoutRecord{Previous: r.previous, Branch: branch}
+
+	r.logf("Checking which of the remotes %s exist", strings.Join(r.remotes, ", "))
+	available, err := r.availableRemotes()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if len(available) == 0 {
+		if remoteOnly {
+			r.logf("No remote available")
+			r.result = resultSkipped + ": no remote"
+			return
+		}
+		if noCreate {
+			r.err = errors.New("no remote available and --no-create is set")
+			return
+		}
+		// without remote the branch starts from the current commit
+		from := r.base
+		if from == "" {
+			from = "HEAD"
+		}
+		r.logf("No remote available, creating local branch from %s", from)
+		if r.stash() && r.createBranch(from, false) {
+			r.result = fmt.Sprintf(resultCreated, from)
+		}
+		return
+	}
+
+	for _, remote := range available {
+		r.logf("Checking if branch exists in %s", remote)
+		err := backend.HasBranch(r.folder, remote, branch)
+		if err == nil {
+			r.remote = remote
+			break
+		}
+		if !errors.Is(err, git.ErrBranchNotFound) {
+			r.err = err
+			return
+		}
+	}
+	if r.remote == "" {
+		if remoteOnly {
+			r.logf("Branch not available on any remote")
+			r.result = resultSkipped + ": not on remote"
+			return
+		}
+		if noCreate {
+			r.err = fmt.Errorf("branch %s doesn't exist on %s and --no-create is set", branch, strings.Join(available, ", "))
+			return
+		}
+		if !r.fetch(available[0]) {
+			return
+		}
+		from, err := r.baseRef(available[0])
+		if err != nil {
+			r.err = err
+			return
 		}
+		r.logf("Branch not available on any remote, creating it from %s", from)
+		if r.stash() && r.createBranch(from, false) {
+			r.result = fmt.Sprintf(resultCreated, from)
+		}
+		return
+	}
+	if !r.fetch(r.remote) {
+		return
+	}
+	tracked := r.remote + "/" + branch
+	r.logf("Checking out branch " + tracked)
+	if r.stash() && r.createBranch(tracked, true) {
+		r.result = fmt.Sprintf(resultTracking, tracked)
+	}
+}
+
+// availableRemotes returns the remotes of the search list which exist in r,
+// in the order of the list
+func (r *repo) availableRemotes() ([]string, error) {
+	existing, err := backend.Remotes(r.folder)
+	if err != nil {
+		return nil, err
+	}
+	available := []string{}
+	for _, remote := range r.remotes {
+		if contains(existing, remote) {
+			available = append(available, remote)
+		}
+	}
+	return available, nil
+}
+
+// fetch fetches remote, false is returned if it failed
+func (r *repo) fetch(remote string) bool {
+	r.logf("Fetching %s", remote)
+	r.err = r.change("fetch "+remote, func() (string, error) {
+		return "", backend.Fetch(r.folder, remote)
+	})
+	return r.err == nil
+}
+
+// goBack returns r to the branch it was on before the last git-co and pops
+// the stash made by it
+func goBack(r *repo) {
+	if r.record == nil {
+		r.result = resultSkipped + ": no git-co to go back from"
+		return
+	}
+	r.current = r.record.Previous
+	r.logf("Checking out %s", r.record.Previous)
+	if !r.checkout(r.record.Previous) {
+		return
+	}
+	r.result = fmt.Sprintf(resultBack, r.record.Previous)
+	if r.record.Stash == "" {
+		return
+	}
+	stashes, err := backend.Stashes(r.folder)
+	if err != nil {
+		r.err = err
+		return
+	}
+	for _, st := range stashes {
+		if st.Message != r.record.Stash {
+			continue
+		}
+		r.logf("Restoring stash %s", st.Ref)
+		err := r.change("stash pop "+st.Ref, func() (string, error) {
+			return "", backend.PopStash(r.folder, st.Ref)
+		})
+		if err != nil {
+			r.err = fmt.Errorf("%s, the changes are kept in %s", err, st.Ref)
+			return
+		}
+		r.stashed = true
+		r.result += ", stash restored"
+		return
+	}
+	r.result += ", stash not found anymore"
+}
+
+// baseRef returns the ref a new branch starts from. A configured base is
+// taken from remote if there is no local branch of that name. Without one
+// the default branch of remote is used.
+func (r *repo) baseRef(remote string) (string, error) {
+	if r.base != "" {
+		if backend.RefExists(r.folder, r.base) {
+			return r.base, nil
+		}
+		return remote + "/" + r.base, nil
+	}
+	def, err := backend.DefaultBranch(r.folder, remote)
+	if err != nil {
+		return "", fmt.Errorf("couldn't detect the default branch of %s, set one with --base or bases.%s in the config: %s", remote, r.services[0], err)
+	}
+	return remote + "/" + def, nil
+}
+
+// stash stashes local changes with a message --back finds them by, false
+// is returned if it failed
+func (r *repo) stash() bool {
+	r.logf("Stashing changes in %s", r.folder)
+	msg := fmt.Sprintf("%s %s on %s at %s", stashPrefix, strings.Join(r.services, ","), r.previous, time.Now().Format("2006-01-02 15:04:05"))
+	what := fmt.Sprintf("stash push -m %q", msg)
+	if untracked {
+		what += " --include-untracked"
+	}
+	r.err = r.change(what, func() (string, error) {
+		var err error
+		r.stashed, err = backend.Stash(r.folder, msg, untracked)
+		return "", err
+	})
+	if r.stashed {
+		r.record.Stash = msg
+	}
+	return r.err == nil
+}
+
+// checkout checks out an existing branch or commit, false is returned if
+// it failed
+func (r *repo) checkout(ref string) bool {
+	r.err = r.change("checkout "+ref, func() (string, error) {
+		return backend.Checkout(r.folder, ref)
+	})
+	r.changed = r.err == nil && !dryRun
+	return r.err == nil
+}
+
+// createBranch creates or resets the branch to start and checks it out,
+// false is returned if it failed
+func (r *repo) createBranch(start string, track bool) bool {
+	what := "checkout -B " + branch + " --no-track " + start
+	if track {
+		what = "checkout -B " + branch + " --track " + start
+	}
+	r.err = r.change(what, func() (string, error) {
+		return backend.CreateBranch(r.folder, branch, start, track)
+	})
+	r.changed = r.err == nil && !dryRun
+	return r.err == nil
+}
+
+// change runs fn which modifies the repository and logs its output. In dry
+// run mode the git command it stands for is only printed.
+func (r *repo) change(what string, fn func() (string, error)) error {
+	if dryRun {
+		r.logf("Would run: git " + what)
 		return nil
-	},
+	}
+	out, err := fn()
+	if out != "" {
+		r.logf("%s", strings.Replace(out, "\n", "\n    ", -1))
+	}
+	return err
 }
 
-func execCmd(folder string, name string, args ...string) (bytes.Buffer, bytes.Buffer, error) {
-	var stderr bytes.Buffer
-	var stdout bytes.Buffer
-	cmd := exec.Command(name, args...)
-	cmd.Dir = folder
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+func (r *repo) logf(format string, a ...interface{}) {
+	fmt.Fprintf(&r.out, " "+format+"\n", a...)
+}
+
+// repoRoot returns the top level folder of the repository folder belongs
+// to, or folder itself if it isn't part of one
+func repoRoot(folder string) string {
+	if root, err := backend.Root(folder); err == nil && root != "" {
+		return root
+	}
+	if abs, err := filepath.Abs(folder); err == nil {
+		return abs
+	}
+	return folder
+}
+
+// loadGitBackend sets the backend given by --git-backend or git-backend of
+// the config
+func loadGitBackend() error {
+	name := gitBackendName
+	if name == "" {
+		var err error
+		if name, err = configString("git-backend"); err != nil {
+			return err
+		}
+	}
+	var err error
+	backend, err = git.New(name)
+	return err
+}
+
+// checkoutsPath returns the file keeping the checkouts of git-co
+func checkoutsPath() string {
+	return filepath.Join(filepath.Dir(composeFiles[0]), compose.JournalDir, "git-co.json")
+}
+
+// loadCheckouts returns the checkouts made by git-co per repository, the
+// latest last
+func loadCheckouts() (map[string][]checkoutRecord, error) {
+	records := map[string][]checkoutRecord{}
+	data, err := ioutil.ReadFile(checkoutsPath())
+	if os.IsNotExist(err) {
+		return records, nil
+	}
 	if err != nil {
-		return stdout, stderr, err
+		return nil, err
+	}
+	return records, json.Unmarshal(data, &records)
+}
+
+func saveCheckouts(records map[string][]checkoutRecord) error {
+	for folder, stack := range records {
+		if len(stack) == 0 {
+			delete(records, folder)
+		}
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(checkoutsPath()), 0755); err != nil {
+		return err
+	}
+	return compose.WriteFile(checkoutsPath(), append(data, '\n'))
+}
+
+// repoOf returns the repository the service is built from
+func repoOf(repos []*repo, sv string) *repo {
+	for _, r := range repos {
+		if contains(r.services, sv) {
+			return r
+		}
 	}
-	return stdout, stderr, nil
+	return nil
 }
 
 func init() {
 	RootCmd.AddCommand(gitCoCmd)
 	gitCoCmd.Flags().StringVarP(&branch, "branch", "b", "", "the branch which should be checked out from the remote origin")
-	gitCoCmd.Flags().BoolVarP(&remoteOnly, "remoteOnly", "r", false, "when no service names are given, only check out given branch if it exists in remote origin ")
+	gitCoCmd.Flags().BoolVarP(&remoteOnly, "remoteOnly", "r", false, "when no service names are given, only check out given branch if it exists on a remote")
+	gitCoCmd.Flags().BoolVar(&rewriteRemote, "rewrite-remote", false, "point git url build contexts like https://host/team/api.git#develop to the branch instead of skipping them")
+	gitCoCmd.Flags().StringVar(&base, "base", "", "ref new branches are created from if the branch doesn't exist on the remote, defaults to bases.<service> of the config or the default branch of origin")
+	gitCoCmd.Flags().BoolVar(&noCreate, "no-create", false, "fail instead of creating the branch if it doesn't exist on the remote")
+	gitCoCmd.Flags().BoolVarP(&untracked, "untracked", "u", false, "stash untracked files as well")
+	gitCoCmd.Flags().BoolVar(&back, "back", false, "return to the branches checked out before the last git-co and restore its stashes")
+	gitCoCmd.Flags().StringArrayVar(&remotes, "remote", nil, "remote to look for the branch on, given multiple times they are searched in order. Defaults to remotes.<service> or remote-order of the config, or origin")
+	gitCoCmd.Flags().StringVar(&onDirty, "on-dirty", "stash", "what to do with repositories with local changes: stash them, skip the repository or fail before anything is changed")
+	gitCoCmd.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of repositories processed at once")
+	gitCoCmd.Flags().StringVar(&gitBackendName, "git-backend", "", "how git is run, exec calls the git binary, go-git works in process but can't stash. Defaults to git-backend of the config or exec")
 }
@@ -0,0 +1,114 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ackermannd/cft/git"
+)
+
+func TestServiceRepos(t *testing.T) {
+	dir, files := testProject(t, "docker-compose.yml", `services:
+  api:
+    build: ./repo/api
+  web:
+    build:
+      context: ./repo/web
+  plain:
+    build: ./plain
+  worker:
+    build: https://github.com/org/worker.git#main
+  db:
+    image: postgres:9.6
+  gone:
+    build: ./gone
+`, ".cft.yml", `bases:
+  api: main
+  web: develop
+`)
+	defer os.RemoveAll(dir)
+	for _, folder := range []string{"repo/api", "repo/web", "plain"} {
+		if err := os.MkdirAll(filepath.Join(dir, folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("git", "init", "-q", filepath.Join(dir, "repo")).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s: %s", err, out)
+	}
+	defer func(b git.Backend) { backend = b }(backend)
+	var err error
+	if backend, err = git.New("exec"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(files []string) { composeFiles = files }(composeFiles)
+	composeFiles = files[:1]
+	project, err := loadProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := project.ServiceNames()
+	root, _ := filepath.EvalSymlinks(filepath.Join(dir, "repo"))
+	plain, _ := filepath.EvalSymlinks(filepath.Join(dir, "plain"))
+	folders := func(repos []*repo) map[string][]string {
+		m := map[string][]string{}
+		for _, r := range repos {
+			folder, _ := filepath.EvalSymlinks(r.folder)
+			m[folder] = r.services
+		}
+		return m
+	}
+
+	// git-status and stashes only need to know where the services are built
+	repos, skipped := buildRepos(project, services)
+	if got, want := folders(repos), map[string][]string{root: {"api", "web"}, plain: {"plain"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("buildRepos: got %v, want %v", got, want)
+	}
+	want := map[string]string{
+		"worker": "remote build context",
+		"db":     "no build definition",
+		"gone":   "folder does not exist: " + filepath.Join(dir, "gone"),
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("buildRepos skipped: got %v, want %v", skipped, want)
+	}
+
+	// git-co can't check out web with another base in the same repository
+	repos, skipped, err = serviceRepos(project, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := folders(repos), map[string][]string{root: {"api"}, plain: {"plain"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceRepos: got %v, want %v", got, want)
+	}
+	if r := repoOf(repos, "api"); r == nil || r.base != "main" || !reflect.DeepEqual(r.remotes, []string{"origin"}) {
+		t.Errorf("serviceRepos: api got %+v", r)
+	}
+	want["worker"] = "remote build context, use --rewrite-remote"
+	want["web"] = "base develop differs from main of api in the same repository"
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("serviceRepos skipped: got %v, want %v", skipped, want)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ackermannd/cft/git"
+	"github.com/spf13/cobra"
+)
+
+var expectBranch string
+
+// serviceStatus is the state of the repository a service is built from
+type serviceStatus struct {
+	Service    string      `json:"service" yaml:"service"`
+	Repository string      `json:"repository,omitempty" yaml:"repository,omitempty"`
+	Branch     string      `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Detached   bool        `json:"detached,omitempty" yaml:"detached,omitempty"`
+	Upstream   string      `json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Ahead      int         `json:"ahead" yaml:"ahead"`
+	Behind     int         `json:"behind" yaml:"behind"`
+	Dirty      int         `json:"dirty" yaml:"dirty"`
+	Stashes    int         `json:"stashes" yaml:"stashes"`
+	LastCommit *git.Commit `json:"lastCommit,omitempty" yaml:"lastCommit,omitempty"`
+	// Differs is set if the branch isn't the expected one, or the one most
+	// services are on
+	Differs bool `json:"differs" yaml:"differs"`
+	// Gone is set if the upstream branch was deleted on the remote
+	Gone bool `json:"upstreamGone,omitempty" yaml:"upstreamGone,omitempty"`
+	// Error is set if the state couldn't be read at all, Warnings list the
+	// details which couldn't be read
+	Error    string   `json:"error,omitempty" yaml:"error,omitempty"`
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// gitStatusCmd represents the git-status command
+var gitStatusCmd = &cobra.Command{
+	Use:   "git-status [<service name> <service name> ...]",
+	Short: "Shows the state of the repositories of the services",
+	Long:  `Lists repository, branch, upstream, commits ahead and behind of it, number of changed files, stashes and last commit of the build folders of all or the given services. Services on another branch than the one most services are on, or than the one given with --expect, are marked. With --expect an error is returned if any service is on another branch.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+		if err := loadGitBackend(); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = project.ServiceNames()
+		}
+		repos, skipped := buildRepos(project, args)
+
+		statuses := []*serviceStatus{}
+		for _, sv := range args {
+			if reason, ok := skipped[sv]; ok {
+				statuses = append(statuses, &serviceStatus{Service: sv, Error: reason})
+				continue
+			}
+			st := repoStatus(repoOf(repos, sv).folder)
+			st.Service = sv
+			statuses = append(statuses, st)
+		}
+
+		want := expectBranch
+		if want == "" {
+			want = majorityBranch(statuses)
+		}
+		differing := 0
+		for _, st := range statuses {
+			if want != "" && st.Error == "" && (st.Detached || st.Branch != want) {
+				st.Differs = true
+				differing++
+			}
+		}
+
+		err = printOutput(statuses, func() error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tREPOSITORY\tBRANCH\tUPSTREAM\tAHEAD\tBEHIND\tDIRTY\tSTASHES\tLAST COMMIT")
+			for _, st := range statuses {
+				if st.Error != "" {
+					fmt.Fprintf(w, "%s\t%s\t\t\t\t\t\t\t%s\n", st.Service, st.Repository, st.Error)
+					continue
+				}
+				branch := st.Branch
+				if st.Detached {
+					branch = "detached at " + st.Branch
+				}
+				if st.Differs {
+					branch += " !"
+				}
+				upstream := st.Upstream
+				if upstream == "" {
+					upstream = "-"
+				} else if st.Gone {
+					upstream += " (gone)"
+				}
+				last := "-"
+				if c := st.LastCommit; c != nil {
+					last = fmt.Sprintf("%s %s %s", c.Hash, c.Time.Format("2006-01-02"), c.Subject)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", st.Service, st.Repository, branch, upstream, st.Ahead, st.Behind, st.Dirty, st.Stashes, last)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if differing > 0 {
+				fmt.Printf("\n%d service(s) marked with ! aren't on %s\n", differing, want)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			for _, warning := range st.Warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s: %s\n", st.Service, warning)
+			}
+		}
+		if expectBranch != "" && differing > 0 {
+			return fmt.Errorf("%d service(s) aren't on %s", differing, expectBranch)
+		}
+		return nil
+	},
+}
+
+// repoStatus collects the state of the repository in folder. If it can't be
+// read at all the Error field is set, details which can't be read are left
+// empty and reported in Warnings.
+func repoStatus(folder string) *serviceStatus {
+	st := &serviceStatus{Repository: folder}
+	status, err := backend.Status(folder)
+	if errors.Is(err, git.ErrNotRepository) {
+		st.Error = "not a git repository"
+		return st
+	}
+	if err != nil {
+		st.Error = oneLine(err.Error())
+		return st
+	}
+	st.Branch = headName(status)
+	st.Detached = status.Branch == ""
+	st.Dirty = status.Changes + status.Conflicts + status.Untracked
+
+	warn := func(err error) {
+		st.Warnings = append(st.Warnings, oneLine(err.Error()))
+	}
+	if status.Branch != "" {
+		if st.Upstream, err = backend.Upstream(folder, status.Branch); err != nil {
+			warn(err)
+		}
+	}
+	// the upstream is gone if its branch was deleted on the remote and
+	// pruned by a fetch
+	if st.Upstream != "" && !backend.RefExists(folder, st.Upstream) {
+		st.Gone = true
+	} else if st.Upstream != "" {
+		if st.Ahead, st.Behind, err = backend.AheadBehind(folder, "HEAD", st.Upstream); err != nil {
+			warn(err)
+		}
+	}
+	if stashes, err := backend.Stashes(folder); err == nil {
+		st.Stashes = len(stashes)
+	} else {
+		warn(err)
+	}
+	// a branch without commits has no HEAD
+	if status.Head != "" {
+		if st.LastCommit, err = backend.LastCommit(folder); err != nil {
+			warn(err)
+		}
+	}
+	return st
+}
+
+// oneLine joins the lines of a message, git's stderr would break the table
+func oneLine(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+// majorityBranch returns the branch most of the services are on, or an empty
+// string if there is a tie
+func majorityBranch(statuses []*serviceStatus) string {
+	counts := map[string]int{}
+	for _, st := range statuses {
+		if st.Error == "" && !st.Detached {
+			counts[st.Branch]++
+		}
+	}
+	branches := []string{}
+	for b := range counts {
+		branches = append(branches, b)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		return counts[branches[i]] > counts[branches[j]]
+	})
+	if len(branches) == 0 || (len(branches) > 1 && counts[branches[0]] == counts[branches[1]]) {
+		return ""
+	}
+	return branches[0]
+}
+
+func init() {
+	RootCmd.AddCommand(gitStatusCmd)
+	gitStatusCmd.Flags().StringVar(&expectBranch, "expect", "", "branch all services should be on, defaults to the branch most services are on")
+	gitStatusCmd.Flags().StringVar(&gitBackendName, "git-backend", "", "how git is run, either exec or go-git. Defaults to git-backend of the config or exec")
+	gitStatusCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format, either table, json or yaml")
+}
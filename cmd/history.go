@@ -0,0 +1,64 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Lists the changes recorded in the journal",
+	Long:  `Lists all changes of the compose file which are backed up in the journal, the newest first. The step number can be passed to undo --steps.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkComposeFile()
+		if err != nil {
+			return err
+		}
+
+		entries, err := compose.History(composeFiles)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("No changes recorded")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "STEP\tDATE\tFILES\tCOMMAND")
+		for i, e := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, e.Time.Format("2006-01-02 15:04:05"), strings.Join(e.Files, ", "), e.Command)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,225 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// overrideFile is the default name of the generated override file
+const overrideFile = "docker-compose.cft.yml"
+
+// buildExtension is the service level extension field holding the build
+// definition which is used in the override file
+const buildExtension = "x-cft-build"
+
+const overrideHeader = "# Generated by cft switch --override, changes will be overwritten"
+
+// override is the generated override file, it holds a block for every
+// service switched to build
+type override struct {
+	doc    *compose.Document
+	order  []string
+	blocks map[string][]string
+	// included is set if the override file is one of the project's files
+	included bool
+}
+
+// loadOverride reads the existing override file of the project, if there is one
+func loadOverride(project *compose.Project) (*override, error) {
+	path := overridePath
+	if path == "" {
+		path = filepath.Join(filepath.Dir(composeFiles[0]), overrideFile)
+	}
+	o := &override{blocks: map[string][]string{}}
+	abs, _ := filepath.Abs(path)
+	for _, d := range project.Documents {
+		if p, _ := filepath.Abs(d.Path); p == abs {
+			o.doc = d
+			o.included = true
+		}
+	}
+	if o.doc == nil {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		o.doc = compose.Parse(data)
+		o.doc.Path = path
+	}
+	for _, s := range o.doc.Services() {
+		o.order = append(o.order, s.Name)
+		o.blocks[s.Name] = dedent(o.doc.Lines(s.Node.Line+1, s.Node.End))
+	}
+	return o, nil
+}
+
+func (o *override) has(sv string) bool {
+	_, ok := o.blocks[sv]
+	return ok
+}
+
+// add puts the build definition of the service into the override file. It
+// is taken from the x-cft-build field of the service or from the builds
+// section of the config.
+func (o *override) add(project *compose.Project, sv string) error {
+	defs, err := project.Definitions(sv)
+	if err != nil {
+		return err
+	}
+	for i := len(defs) - 1; i >= 0; i-- {
+		n := defs[i].Node.Child(buildExtension)
+		if n == nil {
+			continue
+		}
+		if len(n.Children) > 0 {
+			o.set(sv, dedent(defs[i].Doc.Lines(n.Line+1, n.End)))
+			return nil
+		}
+		// flow style like {build: ./web} is written in block style
+		m := yaml.MapSlice{}
+		if err := yaml.Unmarshal([]byte(n.Value), &m); err != nil || len(m) == 0 {
+			return fmt.Errorf("%s: %s in %s has to be a mapping of service keys like build", sv, buildExtension, defs[i].Doc.Path)
+		}
+		return o.setValue(sv, m)
+	}
+
+	v, err := localViper()
+	if err != nil {
+		return err
+	}
+	build := v.Get("builds." + sv)
+	if build == nil {
+		build = viper.Get("builds." + sv)
+	}
+	if build == nil {
+		return fmt.Errorf("%s: can't switch to build mode, neither %s nor builds.%s in the config found", sv, buildExtension, sv)
+	}
+	return o.setValue(sv, build)
+}
+
+// setValue sets the block of the service to v in block style
+func (o *override) setValue(sv string, v interface{}) error {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	o.set(sv, strings.Split(strings.TrimRight(string(out), "\n"), "\n"))
+	return nil
+}
+
+func (o *override) set(sv string, block []string) {
+	if !o.has(sv) {
+		o.order = append(o.order, sv)
+	}
+	o.blocks[sv] = block
+}
+
+func (o *override) remove(sv string) {
+	delete(o.blocks, sv)
+	for i, name := range o.order {
+		if name == sv {
+			o.order = append(o.order[:i], o.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// render creates the content of the override file. The version and layout
+// follow the first compose file of the project.
+func (o *override) render(project *compose.Project) []byte {
+	base := project.Documents[0]
+	lines := []string{overrideHeader}
+	if v := base.Root().Child("version"); v != nil {
+		lines = append(lines, base.Line(v.Line))
+	}
+	indent := ""
+	if base.Root().Child("services") != nil {
+		if len(o.order) == 0 {
+			lines = append(lines, "services: {}")
+		} else {
+			lines = append(lines, "services:")
+		}
+		indent = "  "
+	} else if len(o.order) == 0 {
+		lines = append(lines, "{}")
+	}
+
+	// keep the order of the compose files, unknown services go last
+	ordered := []string{}
+	for _, name := range project.ServiceNames() {
+		if o.has(name) {
+			ordered = append(ordered, name)
+		}
+	}
+	for _, name := range o.order {
+		if !contains(ordered, name) {
+			ordered = append(ordered, name)
+		}
+	}
+	for _, name := range ordered {
+		lines = append(lines, indent+name+":")
+		for _, l := range o.blocks[name] {
+			if strings.TrimSpace(l) == "" {
+				lines = append(lines, "")
+				continue
+			}
+			lines = append(lines, indent+"  "+l)
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// dedent removes the indentation of the first line from all lines
+func dedent(lines []string) []string {
+	prefix := ""
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" && !strings.HasPrefix(l, "#") {
+			prefix = l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+			break
+		}
+	}
+	out := []string{}
+	for _, l := range lines {
+		out = append(out, strings.TrimPrefix(strings.TrimRight(l, "\r"), prefix))
+	}
+	for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
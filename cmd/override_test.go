@@ -0,0 +1,60 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverrideBuildExtension(t *testing.T) {
+	cases := []struct {
+		name      string
+		extension string
+		want      string
+	}{
+		{"block", "    x-cft-build:\n      build: ./web\n      volumes:\n        - ./src:/app\n",
+			"  web:\n    build: ./web\n    volumes:\n      - ./src:/app\n"},
+		{"flow", "    x-cft-build: {build: ./web, volumes: [./src:/app]} # dev\n",
+			"  web:\n    build: ./web\n    volumes:\n    - ./src:/app\n"},
+		{"scalar", "    x-cft-build: ./web\n", ""},
+		{"empty", "    x-cft-build:\n", ""},
+	}
+	defer func() { useOverride = false }()
+	useOverride = true
+	for _, c := range cases {
+		dir, files := testProject(t, "docker-compose.yml", "version: '3.7'\nservices:\n  web:\n    image: web:1\n"+c.extension)
+		err := runCommand(t, switchCmd, files, "web")
+		path := filepath.Join(dir, overrideFile)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if got := readFile(t, path); !strings.HasSuffix(got, "services:\n"+c.want) {
+			t.Errorf("%s: got\n%s\nwant the services\n%s", c.name, got, c.want)
+		}
+		os.RemoveAll(dir)
+	}
+}
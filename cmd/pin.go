@@ -0,0 +1,173 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+)
+
+var pinLocal bool
+
+// pinCmd represents the pin command
+var pinCmd = &cobra.Command{
+	Use:   "pin [<service name> <service name> ...]",
+	Short: "Pins images to the digest their tag currently points to",
+	Long:  `Resolves the tag of the image of all or the given services to the digest of its manifest and writes it as name:tag@sha256:..., so every environment runs exactly the same image. The digest is requested from the registry, with --local it is taken from the images pulled by the local docker daemon.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+		images, err := activeImages(project, args)
+		if err != nil {
+			return err
+		}
+
+		client := newRegistryClient()
+		for _, i := range images {
+			ref := compose.ParseReference(i.node.Value)
+			// variables are resolved for the lookup only
+			resolved, err := project.Resolve(i.node.Value)
+			if err != nil {
+				tagWarning(i.service.Name, i.node.Value, err)
+				continue
+			}
+			lookup := compose.ParseReference(resolved)
+			tag := lookup.Tag
+			if tag == "" {
+				tag = "latest"
+			}
+			var digest string
+			if pinLocal {
+				digest, err = localDigest(lookup, tag)
+			} else {
+				digest, err = client.Digest(lookup, tag)
+			}
+			if err != nil {
+				tagWarning(i.service.Name, i.node.Value, err)
+				continue
+			}
+			// a digest alone can't be unpinned, the tag docker used is written too
+			if ref.Tag == "" {
+				ref.Tag = tag
+			}
+			ref.Digest = digest
+			i.service.Doc.SetValue(i.node, ref.String())
+		}
+
+		return saveProject(project)
+	},
+}
+
+// unpinCmd represents the unpin command
+var unpinCmd = &cobra.Command{
+	Use:   "unpin [<service name> <service name> ...]",
+	Short: "Removes the digests from images",
+	Long:  `Removes the digests written by pin from the image of all or the given services, the tags are kept.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+		images, err := activeImages(project, args)
+		if err != nil {
+			return err
+		}
+
+		for _, i := range images {
+			ref := compose.ParseReference(i.node.Value)
+			if ref.Digest == "" {
+				continue
+			}
+			ref.Digest = ""
+			if ref.Tag == "" {
+				// the tag was left out, don't silently switch to latest
+				tagWarning(i.service.Name, i.node.Value, errors.New("image has no tag, the digest is kept"))
+				continue
+			}
+			i.service.Doc.SetValue(i.node, ref.String())
+		}
+
+		return saveProject(project)
+	},
+}
+
+// serviceImage is the active image line of a service
+type serviceImage struct {
+	service *compose.Service
+	node    *compose.Node
+}
+
+// activeImages returns the active image definitions of the given services, of
+// all services if none are given. Services in build mode are skipped.
+func activeImages(project *compose.Project, services []string) ([]serviceImage, error) {
+	if len(services) == 0 {
+		services = project.ServiceNames()
+	}
+	images := []serviceImage{}
+	for _, sv := range services {
+		defs, err := project.Definitions(sv)
+		if err != nil {
+			return nil, err
+		}
+		// like docker-compose the last file defining an image wins
+		for i := len(defs) - 1; i >= 0; i-- {
+			if n := defs[i].Node.Child("image"); n != nil {
+				images = append(images, serviceImage{defs[i], n})
+				break
+			}
+		}
+	}
+	return images, nil
+}
+
+// localDigest returns the digest of the image pulled by the local docker
+// daemon for ref with the given tag
+func localDigest(ref compose.Reference, tag string) (string, error) {
+	name := ref.Name() + ":" + tag
+	out, err := exec.Command("docker", "image", "inspect", "--format", "{{json .RepoDigests}}", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("docker image inspect %s failed, is the image pulled? %s", name, err)
+	}
+	digests := []string{}
+	if err := json.Unmarshal(out, &digests); err != nil {
+		return "", err
+	}
+	for _, d := range digests {
+		r := compose.ParseReference(d)
+		if r.Domain() == ref.Domain() && r.Repository() == ref.Repository() {
+			return r.Digest, nil
+		}
+	}
+	return "", fmt.Errorf("image %s has no digest, it was built locally and never pushed or pulled", name)
+}
+
+func init() {
+	RootCmd.AddCommand(pinCmd)
+	RootCmd.AddCommand(unpinCmd)
+	pinCmd.Flags().BoolVar(&pinLocal, "local", false, "take the digests from the local docker daemon instead of the registry")
+}
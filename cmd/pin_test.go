@@ -0,0 +1,82 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPinUnpin(t *testing.T) {
+	srv, _ := testRegistry([]string{"1.2", "latest"})
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	// the test registry serves the same manifest for HEAD and GET without a
+	// digest header, so the digest is the hash of the manifest
+	digest := func(tag string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(`{"config":{"digest":"sha256:`+tag+`"}}`)))
+	}
+
+	dir, files := testProject(t, "docker-compose.yml", fmt.Sprintf(`services:
+  api:
+    image: %[1]s/team/api:1.2
+  worker:
+    image: %[1]s/team/api
+`, host))
+	defer os.RemoveAll(dir)
+
+	if err := runCommand(t, pinCmd, files); err != nil {
+		t.Fatal(err)
+	}
+	pinned := fmt.Sprintf(`services:
+  api:
+    image: %[1]s/team/api:1.2@%[2]s
+  worker:
+    image: %[1]s/team/api:latest@%[3]s
+`, host, digest("1.2"), digest("latest"))
+	if got := readFile(t, files[0]); got != pinned {
+		t.Fatalf("pin: got\n%s\nwant\n%s", got, pinned)
+	}
+
+	// pinning again resolves the tag, not the digest
+	if err := runCommand(t, pinCmd, files); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, files[0]); got != pinned {
+		t.Errorf("pin of pinned images: got\n%s\nwant\n%s", got, pinned)
+	}
+
+	if err := runCommand(t, unpinCmd, files); err != nil {
+		t.Fatal(err)
+	}
+	unpinned := fmt.Sprintf(`services:
+  api:
+    image: %[1]s/team/api:1.2
+  worker:
+    image: %[1]s/team/api:latest
+`, host)
+	if got := readFile(t, files[0]); got != unpinned {
+		t.Errorf("unpin: got\n%s\nwant\n%s", got, unpinned)
+	}
+}
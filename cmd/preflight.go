@@ -0,0 +1,112 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ackermannd/cft/git"
+)
+
+// States of a repository found by the pre-flight check of git-co
+const (
+	stateClean      = "clean"
+	stateDirty      = "dirty"
+	stateConflicted = "conflicted"
+	stateRebasing   = "rebasing"
+	stateDetached   = "detached"
+	stateNoRepo     = "not-a-repo"
+	stateUnknown    = "unknown"
+)
+
+// repoState classifies the status of a repository. Untracked files only
+// make it dirty if they are stashed as well. A detached HEAD with local
+// changes is dirty, so --on-dirty applies to it. A clean detached HEAD is
+// worked on like a clean branch, --back checks out the commit again.
+func repoState(st *git.Status) string {
+	switch {
+	case st.Operation == git.OpRebase:
+		return stateRebasing
+	case st.Operation != "" || st.Conflicts > 0:
+		return stateConflicted
+	case st.Changes > 0 || (untracked && st.Untracked > 0):
+		return stateDirty
+	case st.Branch == "":
+		return stateDetached
+	}
+	return stateClean
+}
+
+// headName returns the branch checked out, or the commit if the HEAD is
+// detached
+func headName(st *git.Status) string {
+	if st.Branch != "" {
+		return st.Branch
+	}
+	return st.Head
+}
+
+// preflight checks the state of all repositories before anything is changed
+// and prints it. Repositories which can't be worked on get their result set,
+// with --on-dirty=fail an error is returned if any has local changes.
+func preflight(repos []*repo) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tSTATE\tBRANCH\tSERVICES")
+	dirty := 0
+	for _, r := range repos {
+		st, err := backend.Status(r.folder)
+		switch {
+		case errors.Is(err, git.ErrNotRepository):
+			r.state = stateNoRepo
+		case err != nil:
+			r.state = stateUnknown
+			r.err = err
+		default:
+			r.state = repoState(st)
+			r.previous = headName(st)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.folder, r.state, r.previous, strings.Join(r.services, ", "))
+		switch r.state {
+		case stateNoRepo:
+			r.err = fmt.Errorf("%s isn't a git repository", r.folder)
+		case stateRebasing, stateConflicted:
+			r.err = fmt.Errorf("repository is %s, finish or abort it first", r.state)
+		case stateDirty:
+			dirty++
+			if onDirty == "skip" {
+				r.result = resultSkipped + ": local changes"
+			} else if back && onDirty == "stash" {
+				// the stash of git-co is restored, new changes would mix with it
+				r.err = fmt.Errorf("local changes, commit them or use --on-dirty=skip")
+			}
+		}
+	}
+	w.Flush()
+	fmt.Println()
+	if onDirty == "fail" && dirty > 0 {
+		return fmt.Errorf("Aborted, %d repositories have local changes", dirty)
+	}
+	return nil
+}
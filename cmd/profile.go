@@ -0,0 +1,377 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// profileName are the names which can be used as key in the config without
+// quoting. Names are case insensitive, viper lowercases all keys.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// profile lists the services which should be in build or image mode, entries
+// may be globs like *
+type profile struct {
+	Build []string `mapstructure:"build"`
+	Image []string `mapstructure:"image"`
+}
+
+// mode returns the mode the profile wants the service to be in. Exact names
+// win over globs, an empty string is returned for services not in the profile.
+func (p profile) mode(sv string) string {
+	for _, exact := range []bool{true, false} {
+		for _, m := range []struct {
+			mode     string
+			patterns []string
+		}{{compose.ModeBuild, p.Build}, {compose.ModeImage, p.Image}} {
+			for _, pattern := range m.patterns {
+				if exact && pattern == sv {
+					return m.mode
+				}
+				if ok, _ := path.Match(pattern, sv); !exact && ok {
+					return m.mode
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Saves and applies sets of image and build modes",
+	Long: `Profiles are stored in the .cft config in your home folder or in a ` + localConfig + ` next to the compose file, e.g.
+Profile names are case insensitive.
+
+profiles:
+  frontend-dev:
+    build: [web, api]
+    image: ["*"]`,
+}
+
+// profileApplyCmd represents the profile apply command
+var profileApplyCmd = &cobra.Command{
+	Use:   "apply <profile name>",
+	Short: "Puts every service into the mode of the profile",
+	Long:  `Puts every service into the mode of the profile, all files are changed in one go`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, p, err := loadProfile(args)
+		if err != nil {
+			return err
+		}
+		switched, errs := applyProfile(project, p)
+		for _, sw := range switched {
+			fmt.Fprintln(notices(), sw)
+		}
+		for _, err := range errs {
+			printWarning(err.Error())
+		}
+		if err := saveProject(project); err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Couldn't switch %d service(s)", len(errs))
+		}
+		return nil
+	},
+}
+
+// profileDiffCmd represents the profile diff command
+var profileDiffCmd = &cobra.Command{
+	Use:   "diff <profile name>",
+	Short: "Shows what applying the profile would change",
+	Long:  `Shows what applying the profile would change`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, p, err := loadProfile(args)
+		if err != nil {
+			return err
+		}
+		switched, errs := applyProfile(project, p)
+		for _, sw := range switched {
+			fmt.Fprintln(notices(), sw)
+		}
+		for _, err := range errs {
+			printWarning(err.Error())
+		}
+		for _, d := range project.Changed() {
+			printChanges(d.Path, d.Original(), d.String())
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Couldn't switch %d service(s)", len(errs))
+		}
+		return nil
+	},
+}
+
+// profileSaveCmd represents the profile save command
+var profileSaveCmd = &cobra.Command{
+	Use:   "save <profile name>",
+	Short: "Records the current mode of all services as profile",
+	Long:  `Records the current mode of all services as profile in the ` + localConfig + ` next to the compose file`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Exactly one profile name has to be given")
+		}
+		if !profileName.MatchString(args[0]) {
+			return errors.New("Invalid profile name " + args[0] + ", only letters, digits, - and _ are allowed")
+		}
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+
+		infos, errs := project.Infos()
+		for _, err := range errs {
+			printWarning(err.Error())
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Couldn't read %d service(s), profile %s isn't saved", len(errs), args[0])
+		}
+		p := profile{Build: []string{}, Image: []string{}}
+		for _, info := range infos {
+			switch info.Mode {
+			case compose.ModeBuild:
+				p.Build = append(p.Build, info.Name)
+			case compose.ModeImage:
+				p.Image = append(p.Image, info.Name)
+			}
+		}
+		fmt.Printf("Profile %s: build=%v, image=%v\n", args[0], p.Build, p.Image)
+		if dryRun {
+			return nil
+		}
+
+		return writeProfile(args[0], p)
+	},
+}
+
+// writeProfile stores p in the project specific config. The file is edited
+// in place like the compose files, comments and all other keys are kept. An
+// existing profile with the same name in any case is replaced.
+func writeProfile(name string, p profile) error {
+	path := localConfigPath()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	doc := compose.Parse(data)
+	lines := doc.Lines(0, doc.Root().End)
+	values := map[string]string{}
+	for key, list := range map[string][]string{"build": p.Build, "image": p.Image} {
+		if values[key], err = flowList(list); err != nil {
+			return err
+		}
+	}
+
+	profiles := doc.Root().Child("profiles")
+	if profiles == nil {
+		block := []string{"profiles:", "  " + name + ":", "    build: " + values["build"], "    image: " + values["image"]}
+		// keep a final newline as the last line
+		last := len(lines)
+		if lines[last-1] == "" {
+			last--
+		}
+		if last > 0 && strings.TrimSpace(lines[last-1]) != "" {
+			block = append([]string{""}, block...)
+		}
+		lines = append(lines[:last], append(block, lines[last:]...)...)
+		if lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+		return compose.WriteFile(path, []byte(strings.Join(lines, "\n")))
+	}
+	if profiles.Value != "" {
+		return fmt.Errorf("profiles in %s are written in flow style, add %s by hand", path, name)
+	}
+
+	indent := profiles.Indent + 2
+	var existing *compose.Node
+	for _, c := range profiles.Children {
+		if c.Commented {
+			continue
+		}
+		if c.Item {
+			return fmt.Errorf("profiles in %s are a list, they have to be a mapping", path)
+		}
+		indent = c.Indent
+		if strings.EqualFold(c.Key, name) {
+			existing = c
+		}
+	}
+	if existing == nil {
+		// comments indented below the last profile still belong to it
+		end := profiles.End
+		for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "#") && len(lines[end])-len(strings.TrimLeft(lines[end], " \t")) > profiles.Indent {
+			end++
+		}
+		pad := strings.Repeat(" ", indent)
+		block := []string{pad + name + ":", pad + "  build: " + values["build"], pad + "  image: " + values["image"]}
+		lines = append(lines[:end], append(block, lines[end:]...)...)
+		return compose.WriteFile(path, []byte(strings.Join(lines, "\n")))
+	}
+	if existing.Value != "" {
+		return fmt.Errorf("profile %s in %s is written in flow style, change it by hand", existing.Key, path)
+	}
+
+	// set the build and image values of the profile, everything else of it
+	// stays as it is. Block style lists are replaced by flow style ones.
+	pad := strings.Repeat(" ", existing.Indent+2)
+	drop := map[int]bool{}
+	for _, c := range existing.Children {
+		v, ok := values[c.Key]
+		if c.Commented || c.Item || !ok {
+			continue
+		}
+		doc.SetValue(c, v)
+		for i := c.Line + 1; i < c.End; i++ {
+			drop[i] = true
+		}
+		pad = strings.Repeat(" ", c.Indent)
+		delete(values, c.Key)
+	}
+	missing := []string{}
+	for _, key := range []string{"build", "image"} {
+		if v, ok := values[key]; ok {
+			missing = append(missing, pad+key+": "+v)
+		}
+	}
+	lines = doc.Lines(0, doc.Root().End)
+	edited := []string{}
+	for i, line := range lines {
+		if i == existing.End {
+			edited = append(edited, missing...)
+		}
+		if !drop[i] {
+			edited = append(edited, line)
+		}
+	}
+	if existing.End == len(lines) {
+		edited = append(edited, missing...)
+	}
+	return compose.WriteFile(path, []byte(strings.Join(edited, "\n")))
+}
+
+// flowList returns list in yaml flow style like [web, api]
+func flowList(list []string) (string, error) {
+	out, err := yaml.Marshal(struct {
+		List []string `yaml:"list,flow"`
+	}{list})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(out), "list:")), nil
+}
+
+// profiles returns all known profiles, the ones of the project specific
+// config override those in the home folder
+func profiles() (map[string]profile, error) {
+	all := map[string]profile{}
+	if err := viper.UnmarshalKey("profiles", &all); err != nil {
+		return nil, err
+	}
+	v, err := localViper()
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]profile{}
+	if err := v.UnmarshalKey("profiles", &local); err != nil {
+		return nil, err
+	}
+	for name, p := range local {
+		all[name] = p
+	}
+	return all, nil
+}
+
+// loadProfile loads the project and the profile named in args
+func loadProfile(args []string) (*compose.Project, profile, error) {
+	if len(args) != 1 {
+		return nil, profile{}, errors.New("Exactly one profile name has to be given")
+	}
+	project, err := loadProject()
+	if err != nil {
+		return nil, profile{}, err
+	}
+	all, err := profiles()
+	if err != nil {
+		return nil, profile{}, err
+	}
+	p, ok := all[strings.ToLower(args[0])]
+	if !ok {
+		names := []string{}
+		for name := range all {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, profile{}, fmt.Errorf("Unknown profile %s, available profiles: %v", args[0], names)
+	}
+	return project, p, nil
+}
+
+// applyProfile switches all services of the project into the mode of the
+// profile and returns a description of every switch and the errors of the
+// services which can't be switched
+func applyProfile(project *compose.Project, p profile) ([]string, []error) {
+	switched := []string{}
+	errs := []error{}
+	for _, name := range project.ServiceNames() {
+		mode := p.mode(name)
+		if mode == "" {
+			continue
+		}
+		info, err := project.Info(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if mode == info.Mode {
+			continue
+		}
+		if err := checkMode(project, name, mode); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		setMode(project, name, mode)
+		switched = append(switched, fmt.Sprintf("%s: %s -> %s", name, info.Mode, mode))
+	}
+	return switched, errs
+}
+
+func init() {
+	RootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileApplyCmd)
+	profileCmd.AddCommand(profileDiffCmd)
+	profileCmd.AddCommand(profileSaveCmd)
+}
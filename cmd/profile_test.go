@@ -0,0 +1,76 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteProfile(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"new file", "", "profiles:\n  release:\n    build: [api]\n    image: ['*']\n"},
+		{"other keys", "# local settings\ngit-backend: exec # keep exec\n",
+			"# local settings\ngit-backend: exec # keep exec\n\nprofiles:\n  release:\n    build: [api]\n    image: ['*']\n"},
+		{"appended", "profiles:\n  # the dev profile\n  dev:\n    build: [web]\n    # keep this\n\n# trailer\n",
+			"profiles:\n  # the dev profile\n  dev:\n    build: [web]\n    # keep this\n  release:\n    build: [api]\n    image: ['*']\n\n# trailer\n"},
+		{"replaced in any case", "profiles:\n  Release:\n    build: # mine\n    - web\n    other: 1\n",
+			"profiles:\n  Release:\n    build: [api] # mine\n    other: 1\n    image: ['*']\n"},
+		{"no final newline", "profiles:\n    dev:\n        image: [web]",
+			"profiles:\n    dev:\n        image: [web]\n    release:\n      build: [api]\n      image: ['*']"},
+	}
+	for _, c := range cases {
+		dir, files := testProject(t, "docker-compose.yml", "services: {}\n")
+		config := filepath.Join(dir, localConfig)
+		if c.config != "" {
+			if err := ioutil.WriteFile(config, []byte(c.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		composeFiles = files
+		err := writeProfile("release", profile{Build: []string{"api"}, Image: []string{"*"}})
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if got := readFile(t, config); got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, got, c.want)
+		}
+		// viper reads it back with a lowercased name
+		if all, err := profiles(); err != nil || all["release"].mode("api") != "build" || all["release"].mode("web") != "image" {
+			t.Errorf("%s: saved profile can't be read: %v, %v", c.name, all, err)
+		}
+		os.RemoveAll(dir)
+	}
+	composeFiles = nil
+
+	dir, files := testProject(t, "docker-compose.yml", "services: {}\n", localConfig, "profiles: {dev: {build: [web]}}\n")
+	defer os.RemoveAll(dir)
+	composeFiles = files[:1]
+	defer func() { composeFiles = nil }()
+	if err := writeProfile("release", profile{}); err == nil {
+		t.Error("expected an error for flow style profiles")
+	}
+}
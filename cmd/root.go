@@ -22,19 +22,31 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/ackermannd/clifmt"
+	"github.com/ackermannd/cft/compose"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-var composeFile string
+// localConfig is the project specific config file next to the compose file
+const localConfig = ".cft.yml"
+
+var composeFiles []string
 var force bool
+var dryRun bool
+var diffFormat string
+var envFile string
+
+// journalID groups the backups of all files changed by this call
+var journalID = compose.NewEntryID(time.Now())
 
 // RootCmd is the main command that holds all subcommands
 var RootCmd = &cobra.Command{
@@ -46,15 +58,18 @@ var RootCmd = &cobra.Command{
 // Execute calls RootCmdExecute and prints errors if some occurs
 func Execute() {
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(-1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
-	RootCmd.PersistentFlags().StringVarP(&composeFile, "compose-file", "c", os.Getenv("CFT_COMPOSE"), "docker-compose file to change, if none set $CFT_COMPOSE will be used")
+	RootCmd.PersistentFlags().StringArrayVarP(&composeFiles, "compose-file", "c", nil, "docker-compose file to change, can be given multiple times like docker-compose -f. If none set $CFT_COMPOSE or $COMPOSE_FILE will be used")
 	RootCmd.PersistentFlags().BoolVarP(&force, "force", "f", false, "Skips security confirmation prompts")
+	RootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Only prints the planned changes, neither the compose file nor any repository is touched")
+	RootCmd.PersistentFlags().StringVar(&envFile, "env-file", "", "file with the variables used in the compose files, defaults to the .env file next to the compose file")
+	RootCmd.PersistentFlags().StringVar(&diffFormat, "diff-format", "list", "format of printed changes, either list or unified (usable by git apply or patch)")
 }
 
 func initConfig() {
@@ -64,8 +79,53 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+}
+
+// localConfigPath returns the location of the project specific config
+func localConfigPath() string {
+	return filepath.Join(filepath.Dir(composeFiles[0]), localConfig)
+}
+
+// localViper returns the project specific config, it is empty if the file
+// doesn't exist yet
+func localViper() (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(localConfigPath())
+	if _, err := os.Stat(localConfigPath()); err != nil {
+		return v, nil
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// configString returns key from the project specific config, or from the
+// global one if it isn't set there
+func configString(key string) (string, error) {
+	v, err := localViper()
+	if err != nil {
+		return "", err
+	}
+	if v.IsSet(key) {
+		return v.GetString(key), nil
+	}
+	return viper.GetString(key), nil
+}
+
+// configStrings returns the list key from the project specific config, or
+// from the global one if it isn't set there. A single value is a list of one.
+func configStrings(key string) ([]string, error) {
+	v, err := localViper()
+	if err != nil {
+		return nil, err
 	}
+	if v.IsSet(key) {
+		return v.GetStringSlice(key), nil
+	}
+	return viper.GetStringSlice(key), nil
 }
 
 // Confirm will ask the given string as yes/no confirmation on the CLI
@@ -84,42 +144,106 @@ func confirm(q string) bool {
 }
 
 func checkComposeFile() error {
-	if composeFile == "" {
-		clifmt.Settings.Color = clifmt.Red
-		clifmt.Println("Neither -c flag nor CFT_COMPOSE ENV given, trying to use docker-compose.yml in current directoy")
-		clifmt.Settings.Color = ""
-		if _, err := os.Stat("./docker-compose.yml"); err == nil {
-			composeFile = "./docker-compose.yml"
+	if diffFormat != "list" && diffFormat != "unified" {
+		return errors.New("Unknown diff format " + diffFormat + ", use list or unified")
+	}
+	if len(composeFiles) > 0 {
+		return nil
+	}
+	for _, env := range []string{"CFT_COMPOSE", "COMPOSE_FILE"} {
+		if v := os.Getenv(env); v != "" {
+			composeFiles = splitComposePath(v)
+			return nil
+		}
+	}
+
+	// diagnostics go to stderr, stdout may be json or a patch
+	fmt.Fprintln(os.Stderr, "Neither -c flag nor CFT_COMPOSE or COMPOSE_FILE ENV given, trying to use docker-compose.yml in current directoy")
+	if _, err := os.Stat("./docker-compose.yml"); err == nil {
+		composeFiles = []string{"./docker-compose.yml"}
+		// docker-compose picks up the override file automatically as well
+		if _, err := os.Stat("./docker-compose.override.yml"); err == nil {
+			composeFiles = append(composeFiles, "./docker-compose.override.yml")
 		}
 	}
-	if composeFile == "" {
+	if len(composeFiles) == 0 {
 		return errors.New("No docker-compose file set, either set CFT_COMPOSE environment variable or supply via flag")
 	}
 	return nil
 }
 
-func extractService(sv, origData string) string {
-	svReg := regexp.MustCompilePOSIX(".*" + sv + ":")
-	found := svReg.FindString(origData)
-	whitespace := strings.Split(found, sv+":")[0]
-
-	services := regexp.MustCompilePOSIX("^"+whitespace+"[a-zA-Z-]*:( *|\t*)?").FindAllString(origData, -1)
-
-	nxtService := ""
-	if len(services) > 1 {
-		for key, val := range services {
-			if strings.Contains(val, whitespace+sv+":") {
-				if key+1 < len(services) {
-					nxtService = services[key+1]
-				}
-				break
-			}
+// splitComposePath splits a list of compose files the way docker-compose
+// does for COMPOSE_FILE
+func splitComposePath(v string) []string {
+	sep := string(os.PathListSeparator)
+	if s := os.Getenv("COMPOSE_PATH_SEPARATOR"); s != "" {
+		sep = s
+	}
+	files := []string{}
+	for _, f := range strings.Split(v, sep) {
+		if f != "" {
+			files = append(files, f)
 		}
 	}
+	return files
+}
+
+// loadProject loads all compose files in the order they were given
+func loadProject() (*compose.Project, error) {
+	if err := checkComposeFile(); err != nil {
+		return nil, err
+	}
+	return compose.LoadProject(composeFiles, envFile)
+}
+
+// editedFile is a file changed by a command, a compose file or the .env file
+type editedFile struct {
+	path string
+	orig string
+	data string
+}
 
-	allReg := regexp.MustCompile(whitespace + sv + ":\\s([\\w\\s\\W]*)" + nxtService)
-	found = allReg.FindString(origData)
+// saveProject prints the changes of all modified compose files and the .env
+// file and writes them, unless it is a dry run
+func saveProject(p *compose.Project) error {
+	changed := []editedFile{}
+	for _, d := range p.Changed() {
+		changed = append(changed, editedFile{d.Path, d.Original(), d.String()})
+	}
+	if p.Env != nil && p.Env.Changed() {
+		changed = append(changed, editedFile{p.Env.Path, p.Env.Original(), p.Env.String()})
+	}
+	if len(changed) == 0 && diffFormat == "list" {
+		fmt.Println("No changes")
+	}
+	for _, f := range changed {
+		if (len(p.Documents) > 1 || len(changed) > 1) && diffFormat == "list" {
+			fmt.Println(f.path)
+		}
+		printChanges(f.path, f.orig, f.data)
+	}
+	if dryRun {
+		return nil
+	}
+	for _, f := range changed {
+		if err := writeComposeFile(f.path, []byte(f.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	replReg := regexp.MustCompile("(" + whitespace + sv + ":\\s|" + nxtService + ")")
-	return replReg.ReplaceAllString(found, "")
+// writeComposeFile backs up the current content of path in the journal next
+// to the first compose file, where history and undo find it, and replaces it
+// with data
+func writeComposeFile(path string, data []byte) error {
+	if current, err := ioutil.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	j := compose.OpenJournal(composeFiles[0])
+	command := strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+	if err := j.Backup(journalID, path, command); err != nil {
+		return errors.New("Couldn't create backup: " + err.Error())
+	}
+	return compose.WriteFile(path, data)
 }
@@ -0,0 +1,113 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var outputFormat string
+
+// servicesCmd represents the services command
+var servicesCmd = &cobra.Command{
+	Use:   "services [<service name> <service name> ...]",
+	Short: "Lists the services of the compose files",
+	Long:  `Lists name, mode (image or build), image, tag and build path of all or the given services. Multiple compose files are merged like docker-compose does.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+
+		infos := []*compose.Info{}
+		errs := []error{}
+		if len(args) == 0 {
+			infos, errs = project.Infos()
+		}
+		for _, sv := range args {
+			info, err := project.Info(sv)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, info)
+		}
+
+		err = printOutput(infos, func() error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICE\tMODE\tIMAGE\tTAG\tBUILD")
+			for _, i := range infos {
+				build := i.Build
+				if i.Remote {
+					build += " (remote)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", i.Name, i.Mode, i.Image, i.Tag, build)
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			return err
+		}
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("Couldn't read %d service(s)", len(errs))
+		}
+		return nil
+	},
+}
+
+// printOutput prints v in the format chosen by --output, table is used to
+// print the table format
+func printOutput(v interface{}, table func() error) error {
+	switch outputFormat {
+	case "table":
+		return table()
+	case "json":
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "yaml":
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+	default:
+		return errors.New("Unknown output format " + outputFormat + ", use table, json or yaml")
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(servicesCmd)
+	servicesCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format, either table, json or yaml")
+}
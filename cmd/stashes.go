@@ -0,0 +1,101 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ackermannd/cft/git"
+	"github.com/spf13/cobra"
+)
+
+// stashPrefix starts the message of all stashes made by git-co
+const stashPrefix = "cft git-co:"
+
+// stashEntry is a single stash of a repository
+type stashEntry struct {
+	Services []string `json:"services" yaml:"services"`
+	Folder   string   `json:"folder" yaml:"folder"`
+	Ref      string   `json:"ref" yaml:"ref"`
+	Date     string   `json:"date" yaml:"date"`
+	Message  string   `json:"message" yaml:"message"`
+}
+
+// stashesCmd represents the stashes command
+var stashesCmd = &cobra.Command{
+	Use:   "stashes [<service name> <service name> ...]",
+	Short: "Lists the stashes made by git-co",
+	Long:  `Lists the stashes git-co made in the repositories of all or the given services. git-co --back restores the ones of the last checkout, older ones can be restored with git stash pop.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+		if err := loadGitBackend(); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			args = project.ServiceNames()
+		}
+		repos, _ := buildRepos(project, args)
+
+		stashes := []stashEntry{}
+		for _, r := range repos {
+			found, err := backend.Stashes(r.folder)
+			if errors.Is(err, git.ErrNotRepository) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s", r.folder, err)
+			}
+			for _, st := range found {
+				if strings.HasPrefix(st.Message, stashPrefix) {
+					stashes = append(stashes, stashEntry{
+						Services: r.services,
+						Folder:   r.folder,
+						Ref:      st.Ref,
+						Date:     st.Time.Format("2006-01-02 15:04:05 -0700"),
+						Message:  st.Message,
+					})
+				}
+			}
+		}
+
+		return printOutput(stashes, func() error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "SERVICES\tFOLDER\tSTASH\tDATE\tMESSAGE")
+			for _, st := range stashes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", strings.Join(st.Services, ","), st.Folder, st.Ref, st.Date, st.Message)
+			}
+			return w.Flush()
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(stashesCmd)
+	stashesCmd.Flags().StringVar(&gitBackendName, "git-backend", "", "how git is run, either exec or go-git. Defaults to git-backend of the config or exec")
+	stashesCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format, either table, json or yaml")
+}
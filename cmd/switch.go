@@ -23,110 +23,141 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"regexp"
-	"strings"
 
-	"github.com/ackermannd/clifmt"
-	"github.com/aryann/difflib"
+	"github.com/ackermannd/cft/compose"
 	"github.com/spf13/cobra"
 )
 
+var switchTo string
+var useOverride bool
+var overridePath string
+
 // switchCmd represents the switch command
 var switchCmd = &cobra.Command{
 	Use:   "switch <service name> [<service name> <service name> ...]",
 	Short: "Switches comments on image and build commands",
-	Long:  `If for a given service, build commands are commented out, these comments will be removed while image will be commented out and vice versa`,
+	Long:  `If for a given service, build commands are commented out, these comments will be removed while image will be commented out and vice versa. With --to the services are put into the given mode, services already in it stay unchanged. With --override the compose files aren't changed at all, the build definitions of the ` + buildExtension + ` fields or the builds section of the config are written to a separate override file.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := checkComposeFile()
-		if err != nil {
-			return err
-		}
 		if len(args) == 0 {
 			return errors.New("No service name given")
 		}
-		cf, err := os.Open(composeFile)
+		if switchTo != "" && switchTo != compose.ModeImage && switchTo != compose.ModeBuild {
+			return errors.New("Unknown mode " + switchTo + ", use image or build")
+		}
+		project, err := loadProject()
 		if err != nil {
 			return err
 		}
-		defer cf.Close()
 
-		cfd, _ := ioutil.ReadAll(cf)
-		origData := string(cfd)
-
-		replaceData := origData
+		var o *override
+		if useOverride {
+			if o, err = loadOverride(project); err != nil {
+				return err
+			}
+		}
 
+		failed := 0
 		for _, sv := range args {
+			info, err := project.Info(sv)
+			if err != nil {
+				return err
+			}
+			current := info.Mode
+			if o != nil {
+				current = compose.ModeImage
+				if o.has(sv) {
+					current = compose.ModeBuild
+				}
+			}
 
-			toReplace := extractService(sv, origData)
-
-			checkReg := regexp.MustCompile("#(\\s)*image")
-			found := checkReg.FindString(toReplace)
-
-			replaced := ""
-			//we need a workaround placeholder because replaceallString
-			//somehow can handle to replace $1 when it contains whitespaces?
-			//WTF
-			workaround := " __workaround__unique__blablabla__ "
-			if found == "" {
-				//switch from image to build
-				replReg := regexp.MustCompilePOSIX("^( *|\t*)image:")
-				replaced = replReg.ReplaceAllString(toReplace, "#$1"+workaround+"image:")
-
-				replReg = regexp.MustCompilePOSIX("#( *|\t*)?build:")
-				replaced = replReg.ReplaceAllString(replaced, "$1"+workaround+"build:")
-
-				replReg = regexp.MustCompilePOSIX("#( *|\t*)?volumes:")
-				replaced = replReg.ReplaceAllString(replaced, "$1"+workaround+"volumes:")
-
-				replReg = regexp.MustCompilePOSIX("#( *|\t*)?-( *.*/.*)")
-				replaced = replReg.ReplaceAllString(replaced, "$1"+workaround+"-$2")
-
-			} else {
-				// switch to build to image
-				replReg := regexp.MustCompilePOSIX("#( *|\t*)?image:")
-				replaced = replReg.ReplaceAllString(toReplace, "$1"+workaround+"image:")
-
-				replReg = regexp.MustCompilePOSIX("^( *|\t*)?build:")
-				replaced = replReg.ReplaceAllString(replaced, "#$1"+workaround+"build:")
-
-				replReg = regexp.MustCompilePOSIX("^( *|\t*)?volumes:")
-				replaced = replReg.ReplaceAllString(replaced, "#$1"+workaround+"volumes:")
-
-				replReg = regexp.MustCompilePOSIX("^( *|\t*)?-( *.*/.*)")
-				replaced = replReg.ReplaceAllString(replaced, "#$1"+workaround+"-$2")
+			target := switchTo
+			if target == "" {
+				target = compose.ModeBuild
+				if current == compose.ModeBuild || (current == "" && info.Image != "") {
+					target = compose.ModeImage
+				}
+			}
+			if current == target {
+				fmt.Fprintf(notices(), "%s: already in %s mode, unchanged\n", sv, target)
+				continue
 			}
-			replReg := regexp.MustCompile(workaround)
-			replaced = replReg.ReplaceAllString(replaced, "")
 
-			toWrite := strings.Replace(replaceData, toReplace, replaced, 1)
-			replaceData = toWrite
+			switch {
+			case o != nil && target == compose.ModeBuild:
+				err = o.add(project, sv)
+			case o != nil:
+				o.remove(sv)
+			default:
+				if err = checkMode(project, sv, target); err == nil {
+					setMode(project, sv, target)
+				}
+			}
+			if err != nil {
+				printWarning(err.Error())
+				failed++
+			}
 		}
 
-		diff := difflib.Diff(strings.Split(origData, "\n"), strings.Split(replaceData, "\n"))
-		fmt.Println("Changes: ")
-		for _, val := range diff {
-			switch val.Delta.String() {
-			case " ":
-				continue
-			case "-":
-				clifmt.Settings.Color = clifmt.Red
-			case "+":
-				clifmt.Settings.Color = clifmt.Green
+		if o != nil {
+			o.doc.SetContent(o.render(project))
+			if !o.included {
+				project.Documents = append(project.Documents, o.doc)
+				defer fmt.Fprintln(notices(), "Pass "+o.doc.Path+" as additional compose file to docker-compose to use it")
 			}
-			clifmt.Println(val)
 		}
 
-		out := []byte(replaceData)
-		if err := ioutil.WriteFile(composeFile, out, 0666); err != nil {
+		if err := saveProject(project); err != nil {
 			return err
 		}
-
+		if failed > 0 {
+			return fmt.Errorf("Couldn't switch %d service(s)", failed)
+		}
 		return nil
 	},
 }
 
+// checkMode returns an error if the service can't be put into mode because
+// there is no definition for it, not even a commented one
+func checkMode(project *compose.Project, sv, mode string) error {
+	n, err := project.Effective(sv, mode)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return fmt.Errorf("%s: can't switch to %s mode, there is no %s definition, not even a commented one", sv, mode, mode)
+	}
+	return nil
+}
+
+// setMode comments out image or build of the service and enables the other one
+func setMode(project *compose.Project, sv, mode string) {
+	build := mode == compose.ModeBuild
+	setEnabled(project, sv, "image", !build)
+	setEnabled(project, sv, "build", build)
+	setEnabled(project, sv, "volumes", build)
+}
+
+// setEnabled comments key of the given service in or out. The change is done
+// in the compose file which defines key for the service.
+func setEnabled(project *compose.Project, sv, key string, enabled bool) {
+	service, err := project.Owner(sv, key)
+	if err != nil {
+		return
+	}
+	if !enabled {
+		if n := service.Node.Child(key); n != nil {
+			service.Doc.Comment(n)
+		}
+		return
+	}
+	if n := service.Node.CommentedChild(key); n != nil && service.Node.Child(key) == nil {
+		service.Doc.Uncomment(n)
+	}
+}
+
 func init() {
 	RootCmd.AddCommand(switchCmd)
+	switchCmd.Flags().BoolVarP(&useOverride, "override", "o", false, "leave the compose files untouched and write the build definitions from "+buildExtension+" into a generated override file instead")
+	switchCmd.Flags().StringVar(&overridePath, "override-file", "", "path of the generated override file, defaults to "+overrideFile+" next to the compose file")
+	switchCmd.Flags().StringVarP(&switchTo, "to", "t", "", "mode the services should be switched to, either image or build. Without it the mode is toggled")
 }
@@ -21,76 +21,474 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 
-	"github.com/aryann/difflib"
+	"github.com/Masterminds/semver"
+	"github.com/ackermannd/cft/compose"
 	"github.com/spf13/cobra"
 )
 
 var tag string
+var bump string
+var prerelease string
+var constraint string
+var fromRegistry bool
+var registryHost string
+var namespace string
+var tagsFrom string
+var toEnv bool
+var selServices []string
+var selImages []string
+var selGlobs []string
+var selRegexes []string
 
 // tagCmd represents the tag command
 var tagCmd = &cobra.Command{
-	Use:   "tag <image pattern> [<image pattern> <image pattern>...]",
+	Use:   "tag [<image name> <image name>...]",
 	Short: "Changes tags on images in docker-compose files",
-	Long:  `Changes tags of images a docker-compose file. `,
+	Long:  `Changes tags of images a docker-compose file. Images are selected by name, trailing path components like api for team/api are enough, or by --service, --image, --glob and --regex. Instead of setting a fixed tag, semantic version tags can be bumped with --bump and --prerelease. --from applies a whole service to tag mapping at once. With --constraint only tags satisfying it are written. --registry and --namespace move images to another registry or namespace. --to-env moves tags into variables of the .env file, tags set by variables are always changed in .env.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := checkComposeFile()
+		project, err := loadProject()
 		if err != nil {
 			return err
 		}
 
-		if tag == "" && len(args) == 0 && force == false {
-			if !confirm("No tag nor image pattern given, really remove all tags from all images? [y/n]") {
-				os.Exit(0)
-			}
+		if bump != "" && bump != "patch" && bump != "minor" && bump != "major" {
+			return errors.New("Unknown bump " + bump + ", use patch, minor or major")
+		}
+		semantic := bump != "" || prerelease != ""
+		if semantic && tag != "" {
+			return errors.New("Either set a tag or bump the existing one, not both")
+		}
+		if fromRegistry && (semantic || tag != "") {
+			return errors.New("--latest-from-registry can't be combined with --tag, --bump or --prerelease")
+		}
+		if tagsFrom != "" && (semantic || fromRegistry || tag != "") {
+			return errors.New("--from can't be combined with --tag, --bump, --prerelease or --latest-from-registry")
 		}
-		cf, err := os.Open(composeFile)
+		sel, err := newImageSelector(args)
 		if err != nil {
 			return err
 		}
-		defer cf.Close()
-
-		cfd, _ := ioutil.ReadAll(cf)
-		res := string(cfd)
-		if len(args) == 0 {
-			re := regexp.MustCompilePOSIX("(image:[^:]*[^:]*)(:.*)?")
-			rp := "$1"
-			if tag != "" {
-				rp = rp + ":" + tag
+		if tagsFrom != "" && !sel.empty() {
+			return errors.New("--from selects the images by itself, no image name or selector can be given")
+		}
+		var tagMap map[string]string
+		mapName := tagsFrom
+		if tagsFrom == "-" {
+			mapName = "stdin"
+		}
+		if tagsFrom != "" {
+			if tagMap, err = readTagMap(tagsFrom); err != nil {
+				return err
 			}
-			res = re.ReplaceAllString(res, rp)
 		}
-		for _, val := range args {
-			re := regexp.MustCompilePOSIX("(image:[^:]*" + val + "[^:]*)(:.*)?")
-			rp := "$1"
-			if tag != "" {
-				rp = rp + ":" + tag
+		// tags are only removed if nothing else is asked for
+		keepTag := registryHost != "" || namespace != "" || toEnv
+		var constraints *semver.Constraints
+		if constraint != "" {
+			if constraints, err = semver.NewConstraint(constraint); err != nil {
+				return errors.New("Invalid constraint " + constraint + ": " + err.Error())
+			}
+			if !semantic && tag == "" && !fromRegistry && tagMap == nil {
+				return errors.New("A constraint needs either --tag, --bump, --prerelease or --from")
 			}
-			res = re.ReplaceAllString(res, rp)
 		}
 
-		diff := difflib.Diff(strings.Split(string(cfd), "\n"), strings.Split(string(res), "\n"))
-		fmt.Println("Changes: ")
-		for _, val := range diff {
-			if val.Delta.String() != " " {
-				fmt.Println(val)
+		if tag == "" && !semantic && !fromRegistry && !keepTag && tagMap == nil && sel.empty() && force == false {
+			if !confirm("No tag nor image selected, really remove all tags from all images? [y/n]") {
+				os.Exit(0)
 			}
 		}
 
-		out := []byte(res)
-		if err := ioutil.WriteFile(composeFile, out, 0666); err != nil {
-			return err
+		client := newRegistryClient()
+		latest := map[string]string{}
+		mapped := map[string]bool{}
+		preview := tabwriter.NewWriter(notices(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(preview, "SERVICE\tIMAGE\tFILE")
+		matched := 0
+
+		// like docker-compose the last file defining the image of a service
+		// wins, only that file is changed
+		for _, name := range project.ServiceNames() {
+			service, err := project.Owner(name, "image")
+			if err != nil {
+				return err
+			}
+			doc := service.Doc
+			for _, image := range service.Images() {
+				ref := compose.ParseReference(image.Value)
+				resolved, err := project.Resolve(image.Value)
+				if err != nil {
+					resolved = image.Value
+				}
+				if !sel.matches(service.Name, compose.ParseReference(resolved)) {
+					continue
+				}
+				if !image.Commented {
+					fmt.Fprintf(preview, "%s\t%s\t%s\n", service.Name, image.Value, doc.Path)
+					matched++
+				}
+				// tags set by a variable are changed in .env, taking its
+				// current value as docker-compose would
+				current := ref.Tag
+				variable, def, isVariable := compose.TagVariable(ref.Tag)
+				if isVariable {
+					current = def
+					if v, _, ok := project.Lookup(variable); ok {
+						current = v
+					}
+				}
+				next := ref
+				next.Tag = current
+				next.Digest = ""
+				if registryHost != "" {
+					next.Registry = registryHost
+				}
+				if namespace != "" {
+					next.Path = namespace + "/" + path.Base(ref.Path)
+				}
+				switch {
+				case semantic:
+					if next.Tag, err = nextVersion(current); err != nil {
+						tagWarning(service.Name, image.Value, err)
+						continue
+					}
+				case fromRegistry:
+					lookup := next
+					if name, err := project.Resolve(next.Name()); err == nil {
+						lookup = compose.ParseReference(name)
+					}
+					key := lookup.Domain() + "/" + lookup.Repository()
+					if _, ok := latest[key]; !ok {
+						if latest[key], err = latestTag(client, lookup, constraints); err != nil {
+							tagWarning(service.Name, image.Value, err)
+							continue
+						}
+					}
+					if latest[key] == "" {
+						continue
+					}
+					next.Tag = latest[key]
+				case tagMap != nil:
+					key := service.Name
+					if _, ok := tagMap[key]; !ok {
+						key = ref.Name()
+					}
+					t, ok := tagMap[key]
+					if !ok {
+						if !image.Commented {
+							tagWarning(service.Name, image.Value, errors.New("not covered by "+mapName+", unchanged"))
+						}
+						continue
+					}
+					mapped[key] = true
+					next.Tag = t
+				case tag != "" || !keepTag:
+					next.Tag = tag
+				}
+				if constraints != nil {
+					if v, err := semver.NewVersion(next.Tag); err != nil || !constraints.Check(v) {
+						tagWarning(service.Name, image.Value, fmt.Errorf("tag %s doesn't satisfy %s, skipped", next.Tag, constraint))
+						continue
+					}
+				}
+				// a digest identifies the content, it stays valid in another
+				// registry but not for another tag
+				if next.Tag == current {
+					next.Digest = ref.Digest
+				}
+				switch {
+				case isVariable && next.Tag == "":
+					tagWarning(service.Name, image.Value, errors.New("tag is set by "+variable+", it isn't removed"))
+					next.Tag = ref.Tag
+					next.Digest = ref.Digest
+				case isVariable:
+					if next.Tag != current {
+						project.Env.Set(variable, next.Tag)
+					}
+					next.Tag = ref.Tag
+				case toEnv && !image.Commented:
+					variable = tagVariableName(service.Name)
+					if next.Tag == "" {
+						next.Tag = "latest"
+					}
+					project.Env.Set(variable, next.Tag)
+					next.Tag = "${" + variable + ":-" + next.Tag + "}"
+				}
+				value := next.String()
+				if value == image.Value {
+					continue
+				}
+				if ref.Digest != "" && next.Digest == "" {
+					tagWarning(service.Name, image.Value, errors.New("digest removed, run cft pin to pin the new tag"))
+				}
+				doc.SetValue(image, value)
+			}
+		}
+
+		if matched == 0 {
+			fmt.Fprintln(notices(), "No image matched")
+		} else if !sel.empty() {
+			fmt.Fprintln(notices(), "Matched images:")
+			preview.Flush()
 		}
-		return nil
+
+		unknown := []string{}
+		for key := range tagMap {
+			if !mapped[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		sort.Strings(unknown)
+		for _, key := range unknown {
+			printWarning(fmt.Sprintf("warning: %s of %s is neither a service nor an image of the compose files", key, mapName))
+		}
+
+		return saveProject(project)
 	},
 }
 
+// tagVariableName returns the name of the variable holding the tag of a
+// service, API_TAG for api
+func tagVariableName(service string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(service))
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name + "_TAG"
+}
+
+// readTagMap reads a service or image name to tag mapping from a JSON object
+// or an env file of name=tag lines. With - it is read from stdin. If a name
+// is given twice the last tag wins, like in env files.
+func readTagMap(file string) (map[string]string, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, &tags); err != nil {
+			return nil, errors.New("Invalid tag map " + file + ": " + err.Error())
+		}
+		return tags, nil
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid tag map %s, line %d isn't name=tag", file, i+1)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+	}
+	return tags, nil
+}
+
+// imageSelector decides which images are changed. An image is selected if
+// any of the names or selectors matches, without any every image is.
+type imageSelector struct {
+	names    []string
+	services []string
+	images   []string
+	globs    []string
+	regexes  []*regexp.Regexp
+}
+
+// newImageSelector combines the image names given as arguments with the
+// selector flags
+func newImageSelector(names []string) (*imageSelector, error) {
+	sel := &imageSelector{names: names, services: selServices, images: selImages, globs: selGlobs}
+	for _, g := range selGlobs {
+		if _, err := path.Match(g, ""); err != nil {
+			return nil, errors.New("Invalid glob " + g + ": " + err.Error())
+		}
+	}
+	for _, r := range selRegexes {
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return nil, errors.New("Invalid regex " + r + ": " + err.Error())
+		}
+		sel.regexes = append(sel.regexes, re)
+	}
+	return sel, nil
+}
+
+func (s *imageSelector) empty() bool {
+	return len(s.names)+len(s.services)+len(s.images)+len(s.globs)+len(s.regexes) == 0
+}
+
+// matches checks the image of a service against the selectors. Names given
+// as arguments match the full image name or its trailing path components, so
+// api matches team/api but not team/api-gateway. --image, --glob and --regex
+// are checked with and without the registry host.
+func (s *imageSelector) matches(service string, ref compose.Reference) bool {
+	if s.empty() {
+		return true
+	}
+	for _, n := range s.names {
+		if ref.Name() == n || strings.HasSuffix(ref.Name(), "/"+n) {
+			return true
+		}
+	}
+	for _, sv := range s.services {
+		if sv == service {
+			return true
+		}
+	}
+	for _, image := range []string{ref.Name(), ref.Path} {
+		for _, i := range s.images {
+			if i == image {
+				return true
+			}
+		}
+		for _, g := range s.globs {
+			if ok, _ := path.Match(g, image); ok {
+				return true
+			}
+		}
+		for _, re := range s.regexes {
+			if re.MatchString(image) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nextVersion bumps the semantic version tag current as requested by --bump
+// and --prerelease. A v prefix and short forms like 1.2 are kept, as long as
+// the bumped part is part of the tag.
+func nextVersion(current string) (string, error) {
+	v, err := semver.NewVersion(current)
+	if err != nil {
+		if current == "" {
+			current = "latest"
+		}
+		return "", fmt.Errorf("tag %s is no semantic version, skipped", current)
+	}
+	parts := versionParts(current)
+
+	// a bump of a prerelease which gets a new prerelease starts from its
+	// release, 1.4.3-rc.1 becomes 1.4.4-rc.1 and not 1.4.3-rc.1 again
+	base := *v
+	if bump != "" && prerelease != "" && v.Prerelease() != "" {
+		if base, err = v.SetPrerelease(""); err != nil {
+			return "", err
+		}
+	}
+	next := base
+	switch bump {
+	case "":
+	case "patch":
+		next = base.IncPatch()
+		parts = 3
+	case "minor":
+		next = base.IncMinor()
+		if parts < 2 {
+			parts = 2
+		}
+	case "major":
+		next = base.IncMajor()
+	default:
+		return "", errors.New("unknown bump " + bump + ", use patch, minor or major")
+	}
+
+	if prerelease != "" {
+		n := 1
+		if bump == "" {
+			// continue an existing prerelease like rc.1 -> rc.2, otherwise
+			// start the prerelease of the next patch version
+			if strings.HasPrefix(v.Prerelease(), prerelease+".") {
+				counter, err := strconv.Atoi(strings.TrimPrefix(v.Prerelease(), prerelease+"."))
+				if err == nil {
+					n = counter + 1
+				}
+			} else if v.Prerelease() == "" {
+				next = v.IncPatch()
+				parts = 3
+			}
+		}
+		if next, err = next.SetPrerelease(fmt.Sprintf("%s.%d", prerelease, n)); err != nil {
+			return "", err
+		}
+	}
+	return formatVersion(current, &next, parts), nil
+}
+
+// versionParts returns how many of major, minor and patch a tag has
+func versionParts(tag string) int {
+	core := strings.TrimPrefix(tag, "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	return strings.Count(core, ".") + 1
+}
+
+// formatVersion writes v with the given number of parts and the v prefix of
+// the tag it was created from
+func formatVersion(tag string, v *semver.Version, parts int) string {
+	nums := []string{fmt.Sprint(v.Major()), fmt.Sprint(v.Minor()), fmt.Sprint(v.Patch())}
+	if parts > len(nums) {
+		parts = len(nums)
+	}
+	s := strings.Join(nums[:parts], ".")
+	if strings.HasPrefix(tag, "v") {
+		s = "v" + s
+	}
+	if v.Prerelease() != "" {
+		s += "-" + v.Prerelease()
+	}
+	if v.Metadata() != "" {
+		s += "+" + v.Metadata()
+	}
+	return s
+}
+
+// tagWarning reports an image which is left untouched
+func tagWarning(service, image string, err error) {
+	printWarning(fmt.Sprintf("warning: %s: %s: %s", service, image, err))
+}
+
 func init() {
 	RootCmd.AddCommand(tagCmd)
 	tagCmd.Flags().StringVarP(&tag, "tag", "t", "", "set this tag for the image(s), if no tag is set, existing tags will be removed")
+	tagCmd.Flags().StringVar(&bump, "bump", "", "bump the semantic version tag of the image(s), either patch, minor or major")
+	tagCmd.Flags().StringVar(&prerelease, "prerelease", "", "set or increase a prerelease of the semantic version tag, e.g. rc results in 1.4.3-rc.1")
+	tagCmd.Flags().BoolVar(&fromRegistry, "latest-from-registry", false, "set the highest semantic version tag found in the image's registry, or the newest tag if there are no semantic versions")
+	tagCmd.Flags().StringVarP(&tagMatch, "match", "m", "", "only consider registry tags matching this glob, e.g. '1.4.*'")
+	tagCmd.Flags().StringVar(&registryHost, "registry", "", "move the image(s) to this registry host, e.g. registry.local:5000, keeping the tag unless another one is set")
+	tagCmd.Flags().StringVar(&namespace, "namespace", "", "move the image(s) to this repository namespace, e.g. team/backend, keeping the tag unless another one is set")
+	tagCmd.Flags().StringVar(&tagsFrom, "from", "", "set the tags of a JSON or env file mapping service or image names to tags, - reads it from stdin")
+	tagCmd.Flags().StringArrayVar(&selServices, "service", nil, "select the image of this service, can be given multiple times")
+	tagCmd.Flags().StringArrayVar(&selImages, "image", nil, "select images with exactly this name, e.g. team/api, can be given multiple times")
+	tagCmd.Flags().StringArrayVar(&selGlobs, "glob", nil, "select images whose name matches this glob, e.g. 'team/*', can be given multiple times")
+	tagCmd.Flags().StringArrayVar(&selRegexes, "regex", nil, "select images whose name matches this regular expression, can be given multiple times")
+	tagCmd.Flags().BoolVar(&toEnv, "to-env", false, "move the tags into the .env file, image: api:1.2 becomes api:${API_TAG:-1.2} with API_TAG=1.2 in .env")
+	tagCmd.Flags().StringVar(&constraint, "constraint", "", "only write tags satisfying this semantic version constraint, e.g. ~1.4")
 }
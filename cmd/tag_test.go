@@ -0,0 +1,311 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+)
+
+// testProject writes the given compose files into a temporary folder and
+// returns their paths in the given order
+func testProject(t *testing.T, files ...string) (string, []string) {
+	dir, err := ioutil.TempDir("", "cft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for i := 0; i+1 < len(files); i += 2 {
+		path := filepath.Join(dir, files[i])
+		if err := ioutil.WriteFile(path, []byte(files[i+1]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+// runCommand runs cmd on the given compose files like cft -c <file>... would
+func runCommand(t *testing.T, cmd *cobra.Command, files []string, args ...string) error {
+	defer func(files []string) { composeFiles = files }(composeFiles)
+	composeFiles = files
+	return cmd.RunE(cmd, args)
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTagOnlyChangesOwner(t *testing.T) {
+	base := "services:\n  api:\n    image: team/api:1\n  web:\n    image: web:1\n"
+	override := "services:\n  api:\n    image: team/api:2-dev\n#    image: team/api:1-dev\n  web:\n    environment:\n      - DEBUG=1\n"
+	dir, files := testProject(t, "docker-compose.yml", base, "docker-compose.override.yml", override)
+	defer os.RemoveAll(dir)
+
+	defer func() { tag = "" }()
+	tag = "3"
+	if err := runCommand(t, tagCmd, files, "api", "web"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, files[0]), "services:\n  api:\n    image: team/api:1\n  web:\n    image: web:3\n"; got != want {
+		t.Errorf("base file: got\n%s\nwant\n%s", got, want)
+	}
+	if got, want := readFile(t, files[1]), "services:\n  api:\n    image: team/api:3\n#    image: team/api:3\n  web:\n    environment:\n      - DEBUG=1\n"; got != want {
+		t.Errorf("override file: got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	defer func() { bump, prerelease = "", "" }()
+	tests := []struct {
+		current, bump, prerelease string
+		want                      string
+	}{
+		{"1.4.3", "patch", "", "1.4.4"},
+		{"1.4.3", "minor", "", "1.5.0"},
+		{"1.4.3", "major", "", "2.0.0"},
+		{"1.4.3", "", "", "1.4.3"},
+		{"v1.4.3", "patch", "", "v1.4.4"},
+		{"v1.4.3", "major", "", "v2.0.0"},
+		{"1.2", "minor", "", "1.3"},
+		{"1.2", "major", "", "2.0"},
+		{"1.2", "patch", "", "1.2.1"},
+		{"v1", "major", "", "v2"},
+		{"1", "minor", "", "1.1"},
+		{"1.4.3", "", "rc", "1.4.4-rc.1"},
+		{"1.4.4-rc.1", "", "rc", "1.4.4-rc.2"},
+		{"v1.4.4-rc.9", "", "rc", "v1.4.4-rc.10"},
+		{"1.4.4-beta.2", "", "rc", "1.4.4-rc.1"},
+		{"1.4.3-rc.1", "patch", "rc", "1.4.4-rc.1"},
+		{"1.4.3-rc.1", "minor", "rc", "1.5.0-rc.1"},
+		{"1.4.3", "major", "rc", "2.0.0-rc.1"},
+		{"1.4.3-rc.1", "patch", "", "1.4.3"},
+		{"1.2", "", "rc", "1.2.1-rc.1"},
+		{"1.4.3+build.7", "patch", "", "1.4.4"},
+	}
+	for _, tc := range tests {
+		bump, prerelease = tc.bump, tc.prerelease
+		got, err := nextVersion(tc.current)
+		if err != nil {
+			t.Errorf("%s --bump %q --prerelease %q: %v", tc.current, tc.bump, tc.prerelease, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s --bump %q --prerelease %q: got %s, want %s", tc.current, tc.bump, tc.prerelease, got, tc.want)
+		}
+	}
+
+	bump, prerelease = "", ""
+	for _, current := range []string{"", "latest", "stable-alpine"} {
+		if _, err := nextVersion(current); err == nil {
+			t.Errorf("%q: expected an error", current)
+		}
+	}
+	bump = "huge"
+	if _, err := nextVersion("1.0.0"); err == nil {
+		t.Error("unknown bump: expected an error")
+	}
+}
+
+func TestReadTagMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{"json", `{"api": "1.2", "team/web": "2.0"}`, map[string]string{"api": "1.2", "team/web": "2.0"}},
+		{"json with space", "\n  {\"api\": \"1.2\"}\n", map[string]string{"api": "1.2"}},
+		{"empty json", `{}`, map[string]string{}},
+		{"env", "api=1.2\nteam/web=2.0\n", map[string]string{"api": "1.2", "team/web": "2.0"}},
+		{"env without final newline", "api=1.2", map[string]string{"api": "1.2"}},
+		{"comments and empty lines", "# tags of the release\n\napi=1.2\n  # web follows\nweb=2.0\n", map[string]string{"api": "1.2", "web": "2.0"}},
+		{"export and quotes", "export api=\"1.2\"\nweb = '2.0'\r\n", map[string]string{"api": "1.2", "web": "2.0"}},
+		{"tag with equal sign", "api=a=b\n", map[string]string{"api": "a=b"}},
+		{"duplicate keys, the last one wins", "api=1.2\napi=1.3\n", map[string]string{"api": "1.3"}},
+		{"duplicate json keys, the last one wins", `{"api": "1.2", "api": "1.3"}`, map[string]string{"api": "1.3"}},
+		{"empty", "", map[string]string{}},
+	}
+	dir, _ := testProject(t)
+	defer os.RemoveAll(dir)
+	for _, tc := range tests {
+		path := filepath.Join(dir, "tags")
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readTagMap(path)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	invalid := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"missing equal sign", "api=1.2\nweb 2.0\n", "line 2 isn't name=tag"},
+		{"broken json", `{"api": "1.2"`, "Invalid tag map"},
+		{"json with other values", `{"api": 1.2}`, "Invalid tag map"},
+	}
+	for _, tc := range invalid {
+		path := filepath.Join(dir, "tags")
+		if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTagMap(path); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+	if _, err := readTagMap(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
+
+func TestReadTagMapStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+	os.Stdin = r
+	w.WriteString("api=1.2\n")
+	w.Close()
+	got, err := readTagMap("-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"api": "1.2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTagFrom(t *testing.T) {
+	dir, files := testProject(t, "docker-compose.yml", `services:
+  api:
+    image: team/api:1.0
+  web:
+    image: team/web:1.0
+  db:
+    image: postgres:9.6
+`, "tags.env", "api=1.2\nteam/web=2.0\nworker=3.0\n")
+	defer os.RemoveAll(dir)
+	defer func() { tagsFrom = "" }()
+	tagsFrom = files[1]
+
+	// services and image names are mapped, the unknown worker and the
+	// unmapped db only cause warnings
+	if err := runCommand(t, tagCmd, files[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+  api:
+    image: team/api:1.2
+  web:
+    image: team/web:2.0
+  db:
+    image: postgres:9.6
+`
+	if got := readFile(t, files[0]); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestImageSelector(t *testing.T) {
+	defer func() { selServices, selImages, selGlobs, selRegexes = nil, nil, nil, nil }()
+	images := []struct{ service, image string }{
+		{"api", "team/api:1.2"},
+		{"gateway", "team/api-gateway:1.0"},
+		{"web", "registry.local:5000/team/web:2"},
+		{"db", "postgres:9.6"},
+	}
+	tests := []struct {
+		name                              string
+		args, services, imgs, globs, regs []string
+		want                              []string
+	}{
+		{name: "no selector selects all", want: []string{"api", "gateway", "web", "db"}},
+		{name: "exact name", args: []string{"team/api"}, want: []string{"api"}},
+		{name: "trailing path", args: []string{"api"}, want: []string{"api"}},
+		{name: "trailing path with registry", args: []string{"web"}, want: []string{"web"}},
+		{name: "name with registry", args: []string{"registry.local:5000/team/web"}, want: []string{"web"}},
+		{name: "partial component", args: []string{"eam/api"}},
+		{name: "several names", args: []string{"api", "postgres"}, want: []string{"api", "db"}},
+		{name: "service", services: []string{"gateway"}, want: []string{"gateway"}},
+		{name: "unknown service", services: []string{"worker"}},
+		{name: "service is no image name", args: []string{"gateway"}},
+		{name: "image", imgs: []string{"team/api"}, want: []string{"api"}},
+		{name: "image without registry", imgs: []string{"team/web"}, want: []string{"web"}},
+		{name: "image with registry", imgs: []string{"registry.local:5000/team/web"}, want: []string{"web"}},
+		{name: "image is exact", imgs: []string{"api"}},
+		{name: "glob", globs: []string{"team/*"}, want: []string{"api", "gateway", "web"}},
+		{name: "glob with registry", globs: []string{"registry.local:5000/*/*"}, want: []string{"web"}},
+		{name: "glob doesn't cross slashes", globs: []string{"*"}, want: []string{"db"}},
+		{name: "glob prefix", globs: []string{"team/api*"}, want: []string{"api", "gateway"}},
+		{name: "regex", regs: []string{"^team/api$"}, want: []string{"api"}},
+		{name: "regex substring", regs: []string{"api"}, want: []string{"api", "gateway"}},
+		{name: "regex with registry", regs: []string{`^registry\.local`}, want: []string{"web"}},
+		{name: "selectors combined", args: []string{"postgres"}, services: []string{"web"}, globs: []string{"*/api-*"}, want: []string{"gateway", "web", "db"}},
+	}
+	for _, tc := range tests {
+		selServices, selImages, selGlobs, selRegexes = tc.services, tc.imgs, tc.globs, tc.regs
+		sel, err := newImageSelector(tc.args)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		got := []string{}
+		for _, i := range images {
+			if sel.matches(i.service, compose.ParseReference(i.image)) {
+				got = append(got, i.service)
+			}
+		}
+		if len(tc.want) == 0 {
+			tc.want = []string{}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	selServices, selImages, selGlobs, selRegexes = nil, nil, []string{"team/["}, nil
+	if _, err := newImageSelector(nil); err == nil {
+		t.Error("invalid glob: expected an error")
+	}
+	selGlobs, selRegexes = nil, []string{"team/(api"}
+	if _, err := newImageSelector(nil); err == nil {
+		t.Error("invalid regex: expected an error")
+	}
+}
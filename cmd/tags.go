@@ -0,0 +1,165 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/ackermannd/cft/compose"
+	"github.com/ackermannd/cft/registry"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var tagMatch string
+
+// tagsCmd represents the tags command
+var tagsCmd = &cobra.Command{
+	Use:   "tags <service name>",
+	Short: "Lists the tags of a service's image available in its registry",
+	Long:  `Lists the tags of a service's image available in its registry, semantic versions first, the highest one on top. Credentials are taken from the docker config, registries listed in insecure-registries of the .cft config are accessed via http.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("Exactly one service name has to be given")
+		}
+		project, err := loadProject()
+		if err != nil {
+			return err
+		}
+		info, err := project.Info(args[0])
+		if err != nil {
+			return err
+		}
+		if info.Image == "" {
+			return errors.New("Service " + args[0] + " has no image")
+		}
+
+		tags, err := newRegistryClient().Tags(compose.ParseReference(info.Image))
+		if err != nil {
+			return err
+		}
+		tags = sortTags(filterTags(tags, tagMatch))
+		return printOutput(tags, func() error {
+			for _, t := range tags {
+				fmt.Println(t)
+			}
+			return nil
+		})
+	},
+}
+
+// newRegistryClient creates a registry client honouring the .cft config
+func newRegistryClient() *registry.Client {
+	c := registry.NewClient()
+	c.Insecure = viper.GetStringSlice("insecure-registries")
+	return c
+}
+
+// filterTags returns the tags matching the glob, all tags if it is empty
+func filterTags(tags []string, match string) []string {
+	if match == "" {
+		return tags
+	}
+	matching := []string{}
+	for _, t := range tags {
+		if ok, _ := path.Match(match, t); ok {
+			matching = append(matching, t)
+		}
+	}
+	return matching
+}
+
+// sortTags sorts semantic versions descending followed by all other tags in
+// alphabetical order
+func sortTags(tags []string) []string {
+	versions := semver.Collection{}
+	others := []string{}
+	for _, t := range tags {
+		if v, err := semver.NewVersion(t); err == nil {
+			versions = append(versions, v)
+		} else {
+			others = append(others, t)
+		}
+	}
+	sort.Sort(sort.Reverse(versions))
+	sort.Strings(others)
+	sorted := []string{}
+	for _, v := range versions {
+		sorted = append(sorted, v.Original())
+	}
+	return append(sorted, others...)
+}
+
+// latestTag returns the highest semantic version tag of ref's repository
+// which matches --match and the constraints, prereleases are ignored. If
+// there is no such tag, the tag of the most recently created image matching
+// --match is returned.
+func latestTag(client *registry.Client, ref compose.Reference, constraints *semver.Constraints) (string, error) {
+	tags, err := client.Tags(ref)
+	if err != nil {
+		return "", err
+	}
+	tags = filterTags(tags, tagMatch)
+
+	var latest *semver.Version
+	others := []string{}
+	for _, t := range tags {
+		v, err := semver.NewVersion(t)
+		if err != nil {
+			others = append(others, t)
+			continue
+		}
+		if v.Prerelease() != "" || (constraints != nil && !constraints.Check(v)) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest != nil {
+		return latest.Original(), nil
+	}
+	if constraints != nil || len(others) == 0 {
+		return "", fmt.Errorf("no matching tag found in %s", ref.Domain())
+	}
+
+	newest, newestTime := "", ""
+	for _, t := range others {
+		created, err := client.Created(ref, t)
+		if err != nil {
+			return "", err
+		}
+		if c := created.UTC().Format("20060102150405.000000000"); c > newestTime {
+			newest, newestTime = t, c
+		}
+	}
+	return newest, nil
+}
+
+func init() {
+	RootCmd.AddCommand(tagsCmd)
+	tagsCmd.Flags().StringVarP(&tagMatch, "match", "m", "", "only list tags matching this glob, e.g. '1.4.*'")
+	tagsCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format, either table, json or yaml")
+}
@@ -0,0 +1,104 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/ackermannd/cft/compose"
+	"github.com/ackermannd/cft/registry"
+)
+
+// testRegistry serves team/api with the given tags, the images of tags which
+// aren't versions are created in the given order one day apart
+func testRegistry(tags []string) (*httptest.Server, compose.Reference) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/team/api/tags/list":
+			fmt.Fprintf(w, `{"name":"team/api","tags":["%s"]}`, strings.Join(tags, `","`))
+		case strings.HasPrefix(r.URL.Path, "/v2/team/api/manifests/"):
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/team/api/manifests/")
+			fmt.Fprintf(w, `{"config":{"digest":"sha256:%s"}}`, tag)
+		case strings.HasPrefix(r.URL.Path, "/v2/team/api/blobs/sha256:"):
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/team/api/blobs/sha256:")
+			for i, t := range tags {
+				if t == tag {
+					fmt.Fprintf(w, `{"created":"2016-05-%02dT10:00:00Z"}`, i+1)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, compose.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/team/api:1")
+}
+
+func TestLatestTag(t *testing.T) {
+	versions := []string{"1.2.0", "1.10.0", "1.11.0-rc1", "2.0.0", "latest"}
+	cases := []struct {
+		tags       []string
+		match      string
+		constraint string
+		want       string
+	}{
+		{versions, "", "", "2.0.0"},
+		{versions, "1.*", "", "1.10.0"},
+		{versions, "", "<2.0.0", "1.10.0"},
+		{versions, "", "~1.2", "1.2.0"},
+		{versions, "", ">2", ""},
+		{versions, "3.*", "", ""},
+		{[]string{"stable", "edge", "nightly"}, "", "", "nightly"},
+		{[]string{"stable", "edge", "nightly"}, "e*", "", "edge"},
+		{[]string{"stable", "edge"}, "", ">1", ""},
+	}
+	defer func() { tagMatch = "" }()
+	for _, c := range cases {
+		srv, ref := testRegistry(c.tags)
+		var constraints *semver.Constraints
+		if c.constraint != "" {
+			var err error
+			if constraints, err = semver.NewConstraint(c.constraint); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tagMatch = c.match
+		got, err := latestTag(&registry.Client{HTTP: http.DefaultClient}, ref, constraints)
+		srv.Close()
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%v match %q constraint %q: expected an error, got %s", c.tags, c.match, c.constraint, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v match %q constraint %q: %s", c.tags, c.match, c.constraint, err)
+		} else if got != c.want {
+			t.Errorf("%v match %q constraint %q: got %s, want %s", c.tags, c.match, c.constraint, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ackermannd/cft/compose"
+	"github.com/spf13/cobra"
+)
+
+var steps int
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Restores the compose file from the journal",
+	Long:  `Every change of the compose file is backed up in the ` + compose.JournalDir + ` folder next to the first compose file. Undo restores the state before the last change, or before the last N changes when --steps is given. Restored backups are removed from the journal.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkComposeFile()
+		if err != nil {
+			return err
+		}
+		if steps < 1 {
+			return errors.New("Steps have to be at least 1")
+		}
+
+		entries, err := compose.History(composeFiles)
+		if err != nil {
+			return err
+		}
+		if len(entries) < steps {
+			return fmt.Errorf("Only %d changes in the journal, can't undo %d", len(entries), steps)
+		}
+
+		// entries are restored newest first, so every file ends up in the
+		// state before the oldest restored change
+		for _, e := range entries[:steps] {
+			fmt.Fprintln(notices(), "Restoring state before: "+e.Command)
+			for _, f := range e.Files {
+				backup, err := e.Read(f)
+				if err != nil {
+					return err
+				}
+				current, _ := ioutil.ReadFile(f)
+				if len(e.Files) > 1 && diffFormat == "list" {
+					fmt.Println(f)
+				}
+				printChanges(f, string(current), string(backup))
+			}
+			if dryRun {
+				continue
+			}
+			if err := e.Restore(); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(undoCmd)
+	undoCmd.Flags().IntVarP(&steps, "steps", "n", 1, "number of changes to undo")
+}
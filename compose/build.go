@@ -0,0 +1,178 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Build is a build definition, either the short form holding the context
+// only or the long form mapping
+type Build struct {
+	Context    string            `json:"context" yaml:"context"`
+	Dockerfile string            `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	Target     string            `json:"target,omitempty" yaml:"target,omitempty"`
+	Args       map[string]string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// ParseBuild reads the build definition of n. The children of a commented
+// out build node are read as well.
+func ParseBuild(n *Node) (*Build, error) {
+	if IsFlow(n.Value) {
+		b := &Build{}
+		if err := yaml.Unmarshal([]byte(n.Value), b); err != nil {
+			return nil, fmt.Errorf("invalid build definition %s: %s", n.Value, err)
+		}
+		return b, nil
+	}
+	b := &Build{Context: n.Value}
+	for _, c := range n.Children {
+		if c.Commented != n.Commented || c.Item {
+			continue
+		}
+		switch c.Key {
+		case "context":
+			b.Context = c.Value
+		case "dockerfile":
+			b.Dockerfile = c.Value
+		case "target":
+			b.Target = c.Value
+		case "args":
+			b.Args = map[string]string{}
+			for _, a := range c.Children {
+				if a.Commented != n.Commented {
+					continue
+				}
+				if a.Item {
+					kv := strings.SplitN(a.Value, "=", 2)
+					b.Args[kv[0]] = ""
+					if len(kv) == 2 {
+						b.Args[kv[0]] = kv[1]
+					}
+					continue
+				}
+				b.Args[a.Key] = a.Value
+			}
+		}
+	}
+	return b, nil
+}
+
+// IsFlow reports if value is a flow style mapping or list
+func IsFlow(value string) bool {
+	return strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[")
+}
+
+// GitContext is a build context pointing to a git repository, like
+// https://github.com/team/api.git#develop:docker
+type GitContext struct {
+	URL    string
+	Ref    string
+	Subdir string
+}
+
+// ParseGitContext parses a remote build context, ok is false for local
+// folders. The rules are the ones docker uses to recognize git urls.
+func ParseGitContext(s string) (*GitContext, bool) {
+	url, fragment := s, ""
+	if i := strings.Index(s, "#"); i >= 0 {
+		url, fragment = s[:i], s[i+1:]
+	}
+	remote := strings.HasPrefix(url, "git://") || strings.HasPrefix(url, "git@") || strings.HasPrefix(url, "github.com/")
+	if (strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "http://")) && strings.HasSuffix(url, ".git") {
+		remote = true
+	}
+	if !remote {
+		return nil, false
+	}
+	g := &GitContext{URL: url}
+	parts := strings.SplitN(fragment, ":", 2)
+	g.Ref = parts[0]
+	if len(parts) == 2 {
+		g.Subdir = parts[1]
+	}
+	return g, true
+}
+
+// String returns the context in the form docker understands
+func (g *GitContext) String() string {
+	s := g.URL
+	if g.Ref != "" || g.Subdir != "" {
+		s += "#" + g.Ref
+	}
+	if g.Subdir != "" {
+		s += ":" + g.Subdir
+	}
+	return s
+}
+
+// ContextNode returns the node holding the build context of the service,
+// either the build node itself or its context child
+func (p *Project) ContextNode(name string) (*Service, *Node, error) {
+	s, err := p.Owner(name, "build")
+	if err != nil {
+		return nil, nil, err
+	}
+	n := s.Node.Child("build")
+	if n == nil {
+		n = s.Node.CommentedChild("build")
+	}
+	if n == nil {
+		return nil, nil, fmt.Errorf("service %s has no build definition", name)
+	}
+	if IsFlow(n.Value) {
+		return nil, nil, fmt.Errorf("build definition of service %s is written in flow style, its context can't be changed", name)
+	}
+	if n.Value != "" {
+		return s, n, nil
+	}
+	for _, c := range n.Children {
+		if c.Commented == n.Commented && !c.Item && c.Key == "context" {
+			return s, c, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("build definition of service %s has no context", name)
+}
+
+// Dir returns the project directory, the folder of the first compose file.
+// Like docker-compose all relative paths are relative to it.
+func (p *Project) Dir() string {
+	return filepath.Dir(p.Documents[0].Path)
+}
+
+// BuildContext returns the resolved build context of the service, relative
+// contexts are joined with the project directory, remote ones are returned
+// as they are. An empty string is returned if the service has no build
+// definition.
+func (p *Project) BuildContext(name string) (string, error) {
+	info, err := p.Info(name)
+	if err != nil || info.Build == "" {
+		return "", err
+	}
+	if info.Remote || filepath.IsAbs(info.Build) {
+		return info.Build, nil
+	}
+	return filepath.Join(p.Dir(), info.Build), nil
+}
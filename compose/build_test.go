@@ -0,0 +1,73 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import "testing"
+
+func TestParseGitContext(t *testing.T) {
+	tests := []struct {
+		in   string
+		want *GitContext
+	}{
+		{"https://github.com/org/repo.git", &GitContext{URL: "https://github.com/org/repo.git"}},
+		{"http://git.local/org/repo.git", &GitContext{URL: "http://git.local/org/repo.git"}},
+		{"https://github.com/org/repo.git#v1.2", &GitContext{URL: "https://github.com/org/repo.git", Ref: "v1.2"}},
+		{"https://github.com/org/repo.git#v1.2:docker/api", &GitContext{URL: "https://github.com/org/repo.git", Ref: "v1.2", Subdir: "docker/api"}},
+		{"https://github.com/org/repo.git#:docker", &GitContext{URL: "https://github.com/org/repo.git", Subdir: "docker"}},
+		{"https://github.com/org/repo.git#refs/pull/7/head:api", &GitContext{URL: "https://github.com/org/repo.git", Ref: "refs/pull/7/head", Subdir: "api"}},
+		{"git@github.com:org/repo.git", &GitContext{URL: "git@github.com:org/repo.git"}},
+		{"git@github.com:org/repo.git#feature/login", &GitContext{URL: "git@github.com:org/repo.git", Ref: "feature/login"}},
+		{"git@github.com:org/repo.git#main:api", &GitContext{URL: "git@github.com:org/repo.git", Ref: "main", Subdir: "api"}},
+		{"git://git.local/repo#main", &GitContext{URL: "git://git.local/repo", Ref: "main"}},
+		{"github.com/org/repo", &GitContext{URL: "github.com/org/repo"}},
+		{"github.com/org/repo#main:api", &GitContext{URL: "github.com/org/repo", Ref: "main", Subdir: "api"}},
+
+		// docker only takes http urls ending in .git for repositories
+		{"https://github.com/org/repo", nil},
+		{"https://github.com/org/repo#main", nil},
+		{"https://example.com/context.tar.gz", nil},
+		{".", nil},
+		{"./api", nil},
+		{"../api#main", nil},
+		{"/srv/api", nil},
+		{"api.git", nil},
+		{"", nil},
+	}
+	for _, tc := range tests {
+		got, ok := ParseGitContext(tc.in)
+		if tc.want == nil {
+			if ok {
+				t.Errorf("%q: got %#v, expected a local context", tc.in, got)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%q: not recognized as git context", tc.in)
+			continue
+		}
+		if *got != *tc.want {
+			t.Errorf("%q: got %#v, want %#v", tc.in, got, tc.want)
+		}
+		if s := got.String(); s != tc.in {
+			t.Errorf("%q: String() returned %q", tc.in, s)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package compose provides a model of docker-compose files which keeps
+// comments, ordering and indentation intact. Every modification is done on
+// the affected lines only, everything else is written back byte by byte.
+//
+// The files are read line by line, not by a full yaml parser, so commented
+// out definitions can be parsed as well. Block style mappings and lists are
+// understood. Flow style collections ({a: b}, [a, b]) are kept as the plain
+// value of their key, only build definitions are parsed from them. Anchors
+// are skipped and aliases (*name) and merge keys (<<) aren't resolved,
+// Project.Info reports an error for image and build values which are aliases.
+package compose
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// tabWidth is used to calculate the indentation of lines mixing tabs and spaces
+const tabWidth = 8
+
+// Document is a parsed docker-compose file
+type Document struct {
+	Path  string
+	lines []string
+	orig  string
+	root  *Node
+	// owned marks the lines which are part of a node
+	owned []bool
+}
+
+// Node is a single yaml node of a document. Lines which are commented out but
+// would be a valid key or list item are parsed as well and marked as Commented,
+// so they can be enabled again later on.
+type Node struct {
+	Key       string
+	Value     string
+	Item      bool
+	Commented bool
+	// Anchor is the name of an anchor (&name) in front of the value
+	Anchor string
+	// Line is the index of the line the node starts on, End the index after
+	// the last line of the node including all of its children
+	Line     int
+	End      int
+	Indent   int
+	Parent   *Node
+	Children []*Node
+
+	valStart int
+	valEnd   int
+	quote    byte
+}
+
+// Load reads and parses the docker-compose file at path
+func Load(path string) (*Document, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d := Parse(data)
+	d.Path = path
+	return d, nil
+}
+
+// Parse creates a document from the given file content
+func Parse(data []byte) *Document {
+	d := &Document{lines: strings.Split(string(data), "\n"), orig: string(data)}
+	d.parse()
+	return d
+}
+
+// Bytes returns the current content of the document
+func (d *Document) Bytes() []byte {
+	return []byte(d.String())
+}
+
+// String returns the current content of the document
+func (d *Document) String() string {
+	return strings.Join(d.lines, "\n")
+}
+
+// Original returns the content the document was created with
+func (d *Document) Original() string {
+	return d.orig
+}
+
+// Changed reports if the document was modified since it was created
+func (d *Document) Changed() bool {
+	return d.String() != d.orig
+}
+
+// SetContent replaces the whole content of the document
+func (d *Document) SetContent(data []byte) {
+	d.lines = strings.Split(string(data), "\n")
+	d.parse()
+}
+
+// Lines returns the raw lines from index from up to, but not including, to
+func (d *Document) Lines(from, to int) []string {
+	return append([]string{}, d.lines[from:to]...)
+}
+
+// Root returns the node holding all top level keys of the document
+func (d *Document) Root() *Node {
+	return d.root
+}
+
+// Line returns the raw content of line i
+func (d *Document) Line(i int) string {
+	return d.lines[i]
+}
+
+// SetValue replaces the inline value of n. Quoted values keep their quotes.
+// Nodes on other lines stay valid.
+func (d *Document) SetValue(n *Node, value string) {
+	raw := d.lines[n.Line]
+	if n.quote != 0 {
+		value = quote(value, n.quote)
+	}
+	if n.valStart == n.valEnd && n.valStart == len(strings.TrimRight(raw, "\r")) {
+		value = " " + value
+	} else if n.valStart == n.valEnd && value != "" {
+		// "key: # comment" gets its value in front of the comment
+		value += " "
+	}
+	d.lines[n.Line] = raw[:n.valStart] + value + raw[n.valEnd:]
+	d.parse()
+}
+
+// Comment comments out n together with all of its children. All nodes of the
+// document have to be looked up again afterwards.
+func (d *Document) Comment(n *Node) {
+	for i := n.Line; i < n.End; i++ {
+		if strings.TrimSpace(d.lines[i]) == "" {
+			continue
+		}
+		d.lines[i] = "#" + d.lines[i]
+	}
+	d.parse()
+}
+
+// Uncomment removes one level of comments from n and all of its children. All
+// nodes of the document have to be looked up again afterwards.
+func (d *Document) Uncomment(n *Node) {
+	for i := n.Line; i < n.End; i++ {
+		l := d.lines[i]
+		ws := len(l) - len(strings.TrimLeft(l, " \t"))
+		if ws == len(l) || l[ws] != '#' {
+			continue
+		}
+		// plain comments in between are left as they are
+		if !d.owned[i] && !strings.HasPrefix(strings.TrimLeft(l[ws+1:], " \t"), "#") {
+			continue
+		}
+		if ws > 0 && strings.HasPrefix(l[ws+1:], " ") {
+			// "    # key: value" was commented by hand, not by us
+			d.lines[i] = l[:ws] + l[ws+2:]
+			continue
+		}
+		d.lines[i] = l[:ws] + l[ws+1:]
+	}
+	d.parse()
+}
+
+// Child returns the direct child with the given key which isn't commented out
+func (n *Node) Child(key string) *Node {
+	for _, c := range n.Children {
+		if !c.Commented && !c.Item && c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// CommentedChild returns the first commented out direct child with the given key
+func (n *Node) CommentedChild(key string) *Node {
+	for _, c := range n.Children {
+		if c.Commented && !c.Item && c.Key == key {
+			return c
+		}
+	}
+	return nil
+}
+
+// Items returns all list items of n which aren't commented out
+func (n *Node) Items() []*Node {
+	items := []*Node{}
+	for _, c := range n.Children {
+		if c.Item && !c.Commented {
+			items = append(items, c)
+		}
+	}
+	return items
+}
+
+func (d *Document) parse() {
+	d.root = &Node{Line: -1, Indent: -1}
+	d.owned = make([]bool, len(d.lines))
+	stack := []*Node{d.root}
+	var scalar *Node
+	for i, raw := range d.lines {
+		text := strings.TrimRight(raw, "\r")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		eff, commented := uncomment(text)
+		indent := width(eff)
+
+		// lines of block scalars (key: |) are never parsed as nodes, in an
+		// active one a leading # is part of the text
+		if scalar != nil && ((scalar.Commented == commented && indent > scalar.Indent) || (!scalar.Commented && width(text) > scalar.Indent)) {
+			d.owned[i] = true
+			extend(scalar, i)
+			continue
+		}
+		scalar = nil
+
+		n := parseNode(eff)
+		if n == nil || (commented && !n.Item && strings.ContainsAny(n.Key, " \t") && n.quote == 0) {
+			continue
+		}
+		n.Line = i
+		n.Indent = indent
+		n.Commented = commented
+		shift := len(text) - len(eff)
+		n.valStart += shift
+		n.valEnd += shift
+
+		for len(stack) > 1 {
+			top := stack[len(stack)-1]
+			if top.Indent < indent && (!top.Commented || commented) {
+				break
+			}
+			// yaml allows list items on the same level as their key
+			if top.Indent == indent && n.Item && !top.Item && top.Value == "" && top.Commented == commented {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		n.Parent = parent
+		parent.Children = append(parent.Children, n)
+		d.owned[i] = true
+		extend(n, i)
+		stack = append(stack, n)
+
+		if strings.HasPrefix(n.Value, "|") || strings.HasPrefix(n.Value, ">") {
+			scalar = n
+		}
+	}
+	d.root.End = len(d.lines)
+}
+
+// extend marks line i as part of n and all of its parents
+func extend(n *Node, i int) {
+	for ; n != nil; n = n.Parent {
+		if n.End < i+1 {
+			n.End = i + 1
+		}
+	}
+}
+
+// uncomment strips all leading comment signs of a line. The indentation
+// stays as it was before the line was commented out.
+func uncomment(text string) (string, bool) {
+	commented := false
+	for {
+		ws := len(text) - len(strings.TrimLeft(text, " \t"))
+		if ws == len(text) || text[ws] != '#' {
+			return text, commented
+		}
+		commented = true
+		if ws > 0 && strings.HasPrefix(text[ws+1:], " ") {
+			text = text[:ws] + text[ws+2:]
+			continue
+		}
+		text = text[:ws] + text[ws+1:]
+	}
+}
+
+// width returns the indentation of text with tabs expanded
+func width(text string) int {
+	w := 0
+	for _, c := range text {
+		switch c {
+		case ' ':
+			w++
+		case '\t':
+			w += tabWidth - w%tabWidth
+		default:
+			return w
+		}
+	}
+	return w
+}
+
+// parseNode parses a single uncommented line into a node, nil is returned
+// for lines which are neither a key nor a list item
+func parseNode(text string) *Node {
+	start := len(text) - len(strings.TrimLeft(text, " \t"))
+	rest := text[start:]
+	n := &Node{}
+
+	if rest == "-" || strings.HasPrefix(rest, "- ") || strings.HasPrefix(rest, "-\t") {
+		n.Item = true
+		pos := start + 1
+		pos += len(text[pos:]) - len(strings.TrimLeft(text[pos:], " \t"))
+		n.parseValue(text, pos)
+		return n
+	}
+	if rest == "" || strings.ContainsRune("#{[&*!|>%@`,?", rune(rest[0])) || rest == "---" || rest == "..." {
+		return nil
+	}
+
+	pos := start
+	if rest[0] == '"' || rest[0] == '\'' {
+		end := closingQuote(text, start)
+		if end < 0 {
+			return nil
+		}
+		n.Key = unquote(text[start:end+1], rest[0])
+		pos = end + 1
+		pos += len(text[pos:]) - len(strings.TrimLeft(text[pos:], " \t"))
+		if pos >= len(text) || text[pos] != ':' {
+			return nil
+		}
+	} else {
+		for {
+			if pos >= len(text) {
+				return nil
+			}
+			if text[pos] == '#' && (text[pos-1] == ' ' || text[pos-1] == '\t') {
+				return nil
+			}
+			if text[pos] == ':' && (pos+1 == len(text) || text[pos+1] == ' ' || text[pos+1] == '\t') {
+				break
+			}
+			pos++
+		}
+		n.Key = strings.TrimRight(text[start:pos], " \t")
+	}
+	pos++
+	pos += len(text[pos:]) - len(strings.TrimLeft(text[pos:], " \t"))
+	n.parseValue(text, pos)
+	return n
+}
+
+// parseValue reads the inline value starting at pos up to a trailing comment.
+// An anchor in front of the value is skipped, it stays when the value is set.
+func (n *Node) parseValue(text string, pos int) {
+	if strings.HasPrefix(text[pos:], "&") {
+		end := strings.IndexAny(text[pos:], " \t")
+		if end < 0 {
+			end = len(text) - pos
+		}
+		n.Anchor = text[pos+1 : pos+end]
+		pos += end
+		pos += len(text[pos:]) - len(strings.TrimLeft(text[pos:], " \t"))
+	}
+	n.valStart = pos
+	n.valEnd = pos
+	if pos >= len(text) || text[pos] == '#' {
+		return
+	}
+	if text[pos] == '"' || text[pos] == '\'' {
+		if end := closingQuote(text, pos); end >= 0 {
+			n.quote = text[pos]
+			n.valEnd = end + 1
+			n.Value = unquote(text[pos:end+1], n.quote)
+			return
+		}
+	}
+	end := len(text)
+	for i := pos + 1; i < len(text); i++ {
+		if text[i] == '#' && (text[i-1] == ' ' || text[i-1] == '\t') {
+			end = i
+			break
+		}
+	}
+	n.valEnd = pos + len(strings.TrimRight(text[pos:end], " \t"))
+	n.Value = text[pos:n.valEnd]
+}
+
+// closingQuote returns the index of the quote closing the one at start
+func closingQuote(text string, start int) int {
+	q := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(s string, q byte) string {
+	s = s[1 : len(s)-1]
+	if q == '\'' {
+		return strings.Replace(s, "''", "'", -1)
+	}
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
+
+func quote(s string, q byte) string {
+	if q == '\'' {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
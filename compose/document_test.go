@@ -0,0 +1,176 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+const testFile = `version: "2"
+services:
+  # the api
+  api:
+    image: "team/api:1.2" # pinned later
+#    build:
+#      context: ./api
+#      args:
+#        - MODE=dev
+    volumes: # dev mounts
+    - ./src:/app
+    command: |
+      run --debug
+      # not a key: value
+  web:
+	image: web:1
+	build: {context: ./web, target: dev}
+  db:
+    image: &db postgres:9.6
+`
+
+func TestRoundTrip(t *testing.T) {
+	files := []string{
+		testFile,
+		strings.Replace(testFile, "\n", "\r\n", -1),
+		"",
+		"version: '2'\nservices: {}\n",
+		"api:\n  image: api\n#  build: .\n",
+		"services:\n  api:\n    image: api\n...\n",
+	}
+	for _, f := range files {
+		d := Parse([]byte(f))
+		if got := d.String(); got != f {
+			t.Errorf("round trip changed the file:\n%q\nbecame\n%q", f, got)
+		}
+		if d.Changed() {
+			t.Errorf("unmodified document reports changes: %q", f)
+		}
+		for _, s := range d.Services() {
+			if s.Build() == nil {
+				continue
+			}
+			d.Comment(s.Build())
+			s, _ = d.Service(s.Name)
+			d.Uncomment(s.Build())
+		}
+		if got := d.String(); got != f {
+			t.Errorf("comment and uncomment changed the file:\n%q\nbecame\n%q", f, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	d := Parse([]byte(testFile))
+	api, err := d.Service("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := api.Node.Child("image")
+	if image == nil || image.Value != "team/api:1.2" {
+		t.Fatalf("image = %+v, want team/api:1.2", image)
+	}
+	volumes := api.Node.Child("volumes")
+	if volumes == nil || volumes.Value != "" {
+		t.Fatalf("volumes = %+v, want an empty value", volumes)
+	}
+	if items := volumes.Items(); len(items) != 1 || items[0].Value != "./src:/app" {
+		t.Errorf("items of volumes = %+v, want ./src:/app", items)
+	}
+	if api.Node.Child("command").End != 14 {
+		t.Errorf("block scalar doesn't end after its last line")
+	}
+
+	build := api.Build()
+	if build == nil || !build.Commented {
+		t.Fatalf("commented build not found: %+v", build)
+	}
+	b, err := ParseBuild(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Context != "./api" || b.Args["MODE"] != "dev" {
+		t.Errorf("build = %+v, want context ./api and MODE=dev", b)
+	}
+
+	db, _ := d.Service("db")
+	if n := db.Node.Child("image"); n.Value != "postgres:9.6" || n.Anchor != "db" {
+		t.Errorf("image of db = %q with anchor %q, want postgres:9.6 with anchor db", n.Value, n.Anchor)
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		line, value, want string
+	}{
+		{"    image: api:1.2", "api:1.3", "    image: api:1.3"},
+		{`    image: "api:1.2" # pinned`, "api:1.3", `    image: "api:1.3" # pinned`},
+		{"    image: 'api'", "it's", "    image: 'it''s'"},
+		{"    image:", "api", "    image: api"},
+		{"    image: # none yet", "api", "    image: api # none yet"},
+		{"    image: &img api:1.2", "api:1.3", "    image: &img api:1.3"},
+		{"#    image: api:1.2", "api:1.3", "#    image: api:1.3"},
+	}
+	for _, tt := range tests {
+		d := Parse([]byte("services:\n  api:\n" + tt.line + "\n"))
+		s, err := d.Service("api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.SetValue(s.Images()[0], tt.value)
+		if got := d.Line(2); got != tt.want {
+			t.Errorf("setting %q on %q gave %q, want %q", tt.value, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCommentKeepsChildren(t *testing.T) {
+	d := Parse([]byte("services:\n  api:\n    volumes: # dev mounts\n    - ./src:/app\n    image: api\n"))
+	s, _ := d.Service("api")
+	d.Comment(s.Node.Child("volumes"))
+	want := "services:\n  api:\n#    volumes: # dev mounts\n#    - ./src:/app\n    image: api\n"
+	if got := d.String(); got != want {
+		t.Errorf("commenting volumes gave\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	d := Parse([]byte(testFile))
+	d.Path = "/project/docker-compose.yml"
+	p := &Project{Documents: []*Document{d}}
+
+	info, err := p.Info("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode != ModeBuild || info.Build != "./web" || info.Target != "dev" {
+		t.Errorf("info of web = %+v, want build mode with context ./web and target dev", info)
+	}
+	if _, _, err := p.ContextNode("web"); err == nil {
+		t.Error("context of a flow style build definition can't be changed, expected an error")
+	}
+
+	alias := Parse([]byte("services:\n  api:\n    image: *img\n"))
+	alias.Path = "/project/docker-compose.yml"
+	if _, err := (&Project{Documents: []*Document{alias}}).Info("api"); err == nil {
+		t.Error("expected an error for an aliased image")
+	}
+}
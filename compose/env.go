@@ -0,0 +1,156 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// EnvFileName is the file next to the compose file docker-compose reads
+// variables from
+const EnvFileName = ".env"
+
+// tagVariable matches a tag which is set by a variable, like ${API_TAG:-1.2}
+var tagVariable = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(?::?-([^}]*))?\}$`)
+
+// EnvFile is a file of KEY=value lines. Like documents it keeps everything
+// it doesn't change untouched.
+type EnvFile struct {
+	Path  string
+	lines []string
+	orig  string
+	// newline is false if the last line isn't terminated
+	newline bool
+}
+
+// LoadEnvFile reads an env file, a missing file is treated as empty
+func LoadEnvFile(path string) (*EnvFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	e := &EnvFile{Path: path, orig: string(data), newline: true}
+	if len(data) > 0 {
+		e.newline = strings.HasSuffix(string(data), "\n")
+		e.lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	return e, nil
+}
+
+// Get returns the value of key and whether it is set
+func (e *EnvFile) Get(key string) (string, bool) {
+	if i := e.find(key); i >= 0 {
+		_, value := envLine(e.lines[i])
+		return value, true
+	}
+	return "", false
+}
+
+// Set replaces the value of key, it is appended if it isn't set yet
+func (e *EnvFile) Set(key, value string) {
+	if i := e.find(key); i >= 0 {
+		prefix := ""
+		if strings.HasPrefix(strings.TrimSpace(e.lines[i]), "export ") {
+			prefix = "export "
+		}
+		e.lines[i] = prefix + key + "=" + value
+		return
+	}
+	e.lines = append(e.lines, key+"="+value)
+	e.newline = true
+}
+
+// Keys returns all keys in the order they are defined
+func (e *EnvFile) Keys() []string {
+	keys := []string{}
+	for _, l := range e.lines {
+		if k, _ := envLine(l); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (e *EnvFile) find(key string) int {
+	for i := len(e.lines) - 1; i >= 0; i-- {
+		if k, _ := envLine(e.lines[i]); k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// envLine splits a line into key and value, comments and invalid lines have
+// an empty key
+func envLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	value := strings.TrimSpace(parts[1])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return strings.TrimSpace(parts[0]), value
+}
+
+// String returns the current content
+func (e *EnvFile) String() string {
+	if len(e.lines) == 0 {
+		return ""
+	}
+	if !e.newline {
+		return strings.Join(e.lines, "\n")
+	}
+	return strings.Join(e.lines, "\n") + "\n"
+}
+
+// Bytes returns the current content
+func (e *EnvFile) Bytes() []byte {
+	return []byte(e.String())
+}
+
+// Original returns the content as it was loaded
+func (e *EnvFile) Original() string {
+	return e.orig
+}
+
+// Changed reports whether the content differs from the loaded one
+func (e *EnvFile) Changed() bool {
+	return e.String() != e.orig
+}
+
+// TagVariable returns name and default of the variable a tag like
+// ${API_TAG:-1.2} is set by. ok is false for literal tags.
+func TagVariable(tag string) (name, def string, ok bool) {
+	m := tagVariable.FindStringSubmatch(tag)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
@@ -0,0 +1,78 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		content string
+		key     string
+		value   string
+		want    string
+	}{
+		{"", "", "", ""},
+		{"A=1\n", "", "", "A=1\n"},
+		{"A=1", "", "", "A=1"},
+		{"# tags\nA=1", "A", "2", "# tags\nA=2"},
+		{"export A=1\n", "A", "2", "export A=2\n"},
+		{"A=1", "B", "2", "A=1\nB=2\n"},
+		{"", "B", "2", "B=2\n"},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, EnvFileName)
+		if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e, err := LoadEnvFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.key != "" {
+			e.Set(c.key, c.value)
+		}
+		if got := e.String(); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.content, got, c.want)
+		}
+		if changed := e.Changed(); changed != (c.content != c.want) {
+			t.Errorf("%q: Changed() = %v", c.content, changed)
+		}
+	}
+
+	e, err := LoadEnvFile(filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.String() != "" || e.Changed() {
+		t.Errorf("missing file isn't empty")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultPattern finds variables with a default value
+var defaultPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*):?-([^}$]*)\}`)
+
+// Sources of variable values, besides the path of the env file
+const (
+	SourceEnvironment = "environment"
+	SourceDefault     = "default"
+	SourceUnset       = "unset"
+)
+
+// Variable is a variable referenced in the compose files
+type Variable struct {
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// Interpolate replaces $VAR, ${VAR}, ${VAR:-default}, ${VAR-default},
+// ${VAR:?error}, ${VAR?error}, ${VAR:+alternative} and ${VAR+alternative}
+// the way docker-compose does. $$ is a literal $.
+func Interpolate(s string, lookup func(string) (string, bool)) (string, error) {
+	out := []byte{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		c := s[i+1]
+		switch {
+		case c == '$':
+			out = append(out, '$')
+			i++
+		case c == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("invalid interpolation format in %q, missing }", s)
+			}
+			v, err := expand(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			out = append(out, v...)
+			i = end
+		case isNameChar(c, true):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j], false) {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			out = append(out, v...)
+			i = j - 1
+		default:
+			out = append(out, '$')
+		}
+	}
+	return string(out), nil
+}
+
+// References returns the names of the variables referenced in s in the
+// order they appear, together with the defaults given for them
+func References(s string) ([]string, map[string]string) {
+	names := []string{}
+	seen := map[string]bool{}
+	Interpolate(s, func(name string) (string, bool) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		// pretend everything is set, so required variables don't stop the scan
+		return "x", true
+	})
+	defaults := map[string]string{}
+	for _, m := range defaultPattern.FindAllStringSubmatch(s, -1) {
+		if _, ok := defaults[m[1]]; !ok {
+			defaults[m[1]] = m[2]
+		}
+	}
+	return names, defaults
+}
+
+// expand resolves the content of ${...}
+func expand(expr string, lookup func(string) (string, bool)) (string, error) {
+	name, op, arg := splitExpression(expr)
+	if name == "" {
+		return "", fmt.Errorf("invalid interpolation format ${%s}", expr)
+	}
+	value, set := lookup(name)
+	switch op {
+	case "":
+		return value, nil
+	case ":-", "-":
+		if (op == ":-" && value == "") || !set {
+			return Interpolate(arg, lookup)
+		}
+		return value, nil
+	case ":?", "?":
+		if (op == ":?" && value == "") || !set {
+			msg, err := Interpolate(arg, lookup)
+			if err != nil {
+				return "", err
+			}
+			if msg == "" {
+				return "", fmt.Errorf("required variable %s is missing a value", name)
+			}
+			return "", fmt.Errorf("required variable %s is missing a value: %s", name, msg)
+		}
+		return value, nil
+	case ":+", "+":
+		if (op == ":+" && value == "") || !set {
+			return "", nil
+		}
+		return Interpolate(arg, lookup)
+	}
+	return "", fmt.Errorf("invalid interpolation format ${%s}", expr)
+}
+
+// splitExpression splits the content of ${...} into name, operator and
+// argument
+func splitExpression(expr string) (string, string, string) {
+	i := 0
+	for i < len(expr) && isNameChar(expr[i], i == 0) {
+		i++
+	}
+	name, rest := expr[:i], expr[i:]
+	if rest == "" {
+		return name, "", ""
+	}
+	for _, op := range []string{":-", ":?", ":+", "-", "?", "+"} {
+		if strings.HasPrefix(rest, op) {
+			return name, op, rest[len(op):]
+		}
+	}
+	return "", rest, ""
+}
+
+// closingBrace returns the index of the } closing the variable starting at
+// from, nested variables are skipped
+func closingBrace(s string, from int) int {
+	depth := 1
+	for i := from; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// Lookup returns the value of a variable and where it is set. Like
+// docker-compose the environment of the process wins over the env file.
+func (p *Project) Lookup(name string) (string, string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, SourceEnvironment, true
+	}
+	if p.Env != nil {
+		if v, ok := p.Env.Get(name); ok {
+			return v, p.Env.Path, true
+		}
+	}
+	return "", SourceUnset, false
+}
+
+// Resolve interpolates s with the variables of the project
+func (p *Project) Resolve(s string) (string, error) {
+	return Interpolate(s, func(name string) (string, bool) {
+		v, _, ok := p.Lookup(name)
+		return v, ok
+	})
+}
+
+// Variables returns all variables referenced by active values of the compose
+// files with their resolved value, in the order they are used first
+func (p *Project) Variables() []*Variable {
+	vars := []*Variable{}
+	seen := map[string]*Variable{}
+	for _, d := range p.Documents {
+		walk(d.root, func(n *Node) {
+			names, defaults := References(n.Value)
+			for _, name := range names {
+				def, hasDefault := defaults[name]
+				if v, ok := seen[name]; ok {
+					if v.Source == SourceUnset && hasDefault {
+						v.Value, v.Source = def, SourceDefault
+					}
+					continue
+				}
+				v := &Variable{Name: name}
+				var ok bool
+				if v.Value, v.Source, ok = p.Lookup(name); !ok && hasDefault {
+					v.Value, v.Source = def, SourceDefault
+				}
+				seen[name] = v
+				vars = append(vars, v)
+			}
+		})
+	}
+	return vars
+}
+
+// walk calls fn for all active nodes below n
+func walk(n *Node, fn func(*Node)) {
+	for _, c := range n.Children {
+		if c.Commented {
+			continue
+		}
+		fn(c)
+		walk(c, fn)
+	}
+}
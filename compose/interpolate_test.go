@@ -0,0 +1,124 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import "testing"
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"SET": "value", "EMPTY": "", "OTHER": "other"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	// the results docker compose documents for each form
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"$SET", "value"},
+		{"a-$SET-b", "a-value-b"},
+		{"$SET_2", ""},
+		{"$UNSET", ""},
+		{"${SET}", "value"},
+		{"${SET}_2", "value_2"},
+		{"${UNSET}", ""},
+		{"${SET:-default}", "value"},
+		{"${EMPTY:-default}", "default"},
+		{"${UNSET:-default}", "default"},
+		{"${SET-default}", "value"},
+		{"${EMPTY-default}", ""},
+		{"${UNSET-default}", "default"},
+		{"${UNSET:-}", ""},
+		{"${SET:?must be set}", "value"},
+		{"${SET?must be set}", "value"},
+		{"${EMPTY?must be set}", ""},
+		{"${SET:+alternative}", "alternative"},
+		{"${EMPTY:+alternative}", ""},
+		{"${UNSET:+alternative}", ""},
+		{"${SET+alternative}", "alternative"},
+		{"${EMPTY+alternative}", "alternative"},
+		{"${UNSET+alternative}", ""},
+		{"$$", "$"},
+		{"$$SET", "$SET"},
+		{"$${SET}", "${SET}"},
+		{"$$$SET", "$value"},
+		{"price: 5$", "price: 5$"},
+		{"$ 1", "$ 1"},
+		{"$1", "$1"},
+		{"${UNSET:-${SET}}", "value"},
+		{"${UNSET:-$SET}", "value"},
+		{"${UNSET:-a-${OTHER}-b}", "a-other-b"},
+		{"${UNSET:-${ALSO_UNSET:-deep}}", "deep"},
+		{"${SET:+${OTHER}}", "other"},
+		{"${UNSET:-a:b/c}", "a:b/c"},
+		{"team/api:${UNSET:-1.2}@sha256:1", "team/api:1.2@sha256:1"},
+	}
+	for _, tc := range tests {
+		got, err := Interpolate(tc.in, lookup)
+		if err != nil {
+			t.Errorf("%s: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	invalid := []struct {
+		in, err string
+	}{
+		{"${EMPTY:?must be set}", "required variable EMPTY is missing a value: must be set"},
+		{"${UNSET:?must be set}", "required variable UNSET is missing a value: must be set"},
+		{"${UNSET?must be set}", "required variable UNSET is missing a value: must be set"},
+		{"${UNSET:?}", "required variable UNSET is missing a value"},
+		{"${UNSET:?$OTHER is set}", "required variable UNSET is missing a value: other is set"},
+		{"${UNSET:-${REQUIRED:?needed}}", "required variable REQUIRED is missing a value: needed"},
+		{"${SET", `invalid interpolation format in "${SET", missing }`},
+		{"a ${UNSET:-${SET}", `invalid interpolation format in "a ${UNSET:-${SET}", missing }`},
+		{"${}", "invalid interpolation format ${}"},
+		{"${1SET}", "invalid interpolation format ${1SET}"},
+		{"${SET*x}", "invalid interpolation format ${SET*x}"},
+	}
+	for _, tc := range invalid {
+		got, err := Interpolate(tc.in, lookup)
+		if err == nil {
+			t.Errorf("%s: expected an error, got %q", tc.in, got)
+		} else if err.Error() != tc.err {
+			t.Errorf("%s: got error %q, want %q", tc.in, err, tc.err)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	names, defaults := References("${REGISTRY:-registry.local}/api:${API_TAG-1.2}$$NOT ${REGISTRY} $MODE ${X:?err}")
+	want := []string{"REGISTRY", "API_TAG", "MODE", "X"}
+	if len(names) != len(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("got %v, want %v", names, want)
+		}
+	}
+	if defaults["REGISTRY"] != "registry.local" || defaults["API_TAG"] != "1.2" || len(defaults) != 2 {
+		t.Errorf("got defaults %v", defaults)
+	}
+}
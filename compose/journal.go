@@ -0,0 +1,233 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JournalDir is the name of the folder next to a compose file holding the backups
+const JournalDir = ".cft-journal"
+
+// journalTime is the layout of entry ids, they sort in the order they were created
+const journalTime = "20060102-150405.000000"
+
+// commandFile holds the command line which caused the changes of an entry
+const commandFile = ".command"
+
+// missingSuffix marks backups of files which didn't exist before the change
+const missingSuffix = ".missing"
+
+// Journal keeps backups of compose files. Every entry is a folder holding the
+// content of all files changed by one cft call before they were changed. The
+// backups are named by the escaped path of the file relative to the folder
+// holding the journal, so files in other folders like an env file given with
+// --env-file can be restored as well.
+type Journal struct {
+	Dir string
+}
+
+// Entry is a single set of backups in the journal
+type Entry struct {
+	ID      string
+	Time    time.Time
+	Command string
+	// Files are the paths of the compose files backed up in the entry
+	Files []string
+
+	backups map[string]string
+	dirs    []string
+}
+
+// NewEntryID returns a journal id for changes made at t
+func NewEntryID(t time.Time) string {
+	return t.Format(journalTime)
+}
+
+// OpenJournal returns the journal for the given compose file
+func OpenJournal(composeFile string) *Journal {
+	return &Journal{Dir: filepath.Join(filepath.Dir(composeFile), JournalDir)}
+}
+
+// Backup copies the current content of path into the entry with the given id.
+// If path doesn't exist yet, restoring the entry will remove it again.
+func (j *Journal) Backup(id, path, command string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	backup, relErr := j.backupName(path)
+	if relErr != nil {
+		return relErr
+	}
+	if os.IsNotExist(err) {
+		backup += missingSuffix
+	}
+	dir := filepath.Join(j.Dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	backup = filepath.Join(dir, backup)
+	if _, err := os.Stat(backup); err == nil {
+		// the file was changed twice during one call, keep the first state
+		return nil
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, commandFile), []byte(command), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backup, data, 0644)
+}
+
+// backupName returns the name of the backup of path, its path relative to
+// the folder of the journal with all separators escaped
+func (j *Journal) backupName(path string) (string, error) {
+	base, err := filepath.Abs(filepath.Dir(j.Dir))
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return "", err
+	}
+	return url.PathEscape(filepath.ToSlash(rel)), nil
+}
+
+// Entries returns all entries of the journal, the newest first
+func (j *Journal) Entries() ([]*Entry, error) {
+	infos, err := ioutil.ReadDir(j.Dir)
+	if os.IsNotExist(err) {
+		return []*Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	for _, fi := range infos {
+		t, err := time.ParseInLocation(journalTime, fi.Name(), time.Local)
+		if !fi.IsDir() || err != nil {
+			continue
+		}
+		dir := filepath.Join(j.Dir, fi.Name())
+		e := &Entry{ID: fi.Name(), Time: t, backups: map[string]string{}, dirs: []string{dir}}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.Name() == commandFile {
+				continue
+			}
+			rel, err := url.PathUnescape(strings.TrimSuffix(f.Name(), missingSuffix))
+			if err != nil {
+				return nil, err
+			}
+			path := filepath.Join(filepath.Dir(j.Dir), filepath.FromSlash(rel))
+			e.Files = append(e.Files, path)
+			e.backups[path] = filepath.Join(dir, f.Name())
+		}
+		cmd, _ := ioutil.ReadFile(filepath.Join(dir, commandFile))
+		e.Command = strings.TrimSpace(string(cmd))
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// History returns the entries of the journals next to all given compose
+// files, the newest first. Backups made by the same cft call are combined
+// into one entry, even if the files live in different folders.
+func History(composeFiles []string) ([]*Entry, error) {
+	seen := map[string]bool{}
+	byID := map[string]*Entry{}
+	entries := []*Entry{}
+	for _, f := range composeFiles {
+		j := OpenJournal(f)
+		if seen[j.Dir] {
+			continue
+		}
+		seen[j.Dir] = true
+		found, err := j.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range found {
+			if known, ok := byID[e.ID]; ok {
+				known.Files = append(known.Files, e.Files...)
+				known.dirs = append(known.dirs, e.dirs...)
+				for k, v := range e.backups {
+					known.backups[k] = v
+				}
+				continue
+			}
+			byID[e.ID] = e
+			entries = append(entries, e)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].ID > entries[b].ID
+	})
+}
+
+// Read returns the backed up content of file
+func (e *Entry) Read(file string) ([]byte, error) {
+	return ioutil.ReadFile(e.backups[file])
+}
+
+// Restore writes all backups of e back to their files and removes the entry
+// from the journal
+func (e *Entry) Restore() error {
+	for _, f := range e.Files {
+		if strings.HasSuffix(e.backups[f], missingSuffix) {
+			if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := e.Read(f)
+		if err != nil {
+			return err
+		}
+		if err := WriteFile(f, data); err != nil {
+			return err
+		}
+	}
+	for _, dir := range e.dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
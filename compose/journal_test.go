@@ -0,0 +1,117 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	project := filepath.Join(dir, "project")
+	base := filepath.Join(project, "docker-compose.yml")
+	override := filepath.Join(project, "docker-compose.override.yml")
+	env := filepath.Join(dir, "env", "prod.env")
+	for _, f := range []string{project, filepath.Dir(env)} {
+		if err := os.MkdirAll(f, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return "<missing>"
+		}
+		return string(data)
+	}
+	write(base, "base 1")
+	write(env, "TAG=1")
+
+	// the journal is kept next to the first compose file for all files
+	j := OpenJournal(base)
+	now := time.Now()
+	first, second := NewEntryID(now), NewEntryID(now.Add(time.Second))
+	for _, f := range []string{base, env, override} {
+		if err := j.Backup(first, f, "cft tag -t 2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(base, "base 2")
+	write(env, "TAG=2")
+	write(override, "override 2")
+	if err := j.Backup(second, base, "cft switch api"); err != nil {
+		t.Fatal(err)
+	}
+	// only the first state of a call is kept
+	write(base, "base 3")
+	if err := j.Backup(second, base, "cft switch api"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := History([]string{base, override})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != second || entries[1].ID != first {
+		t.Fatalf("got %d entries, want the second one first", len(entries))
+	}
+	if entries[0].Command != "cft switch api" || len(entries[0].Files) != 1 {
+		t.Errorf("second entry: got %q with files %v", entries[0].Command, entries[0].Files)
+	}
+	if len(entries[1].Files) != 3 {
+		t.Errorf("first entry: got files %v, want base, env and override", entries[1].Files)
+	}
+	if data, err := entries[0].Read(base); err != nil || string(data) != "base 2" {
+		t.Errorf("backup of base: got %q, %v", data, err)
+	}
+
+	if err := entries[0].Restore(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(base); got != "base 2" {
+		t.Errorf("base after undoing the second entry: %q", got)
+	}
+	if err := entries[1].Restore(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{base: "base 1", env: "TAG=1", override: "<missing>"} {
+		if got := read(path); got != want {
+			t.Errorf("%s after undo: got %q, want %q", path, got, want)
+		}
+	}
+	if entries, err := History([]string{base}); err != nil || len(entries) != 0 {
+		t.Errorf("restored entries are still in the journal: %d, %v", len(entries), err)
+	}
+}
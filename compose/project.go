@@ -0,0 +1,214 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Project is a set of compose files which are merged in the given order, like
+// docker-compose does when -f is passed several times
+type Project struct {
+	Documents []*Document
+	// Env holds the variables used for interpolation, by default the .env
+	// file next to the first compose file
+	Env *EnvFile
+}
+
+// LoadProject loads all given compose files and the env file, if envFile is
+// empty the .env file next to the first compose file is used. Only this
+// default file may be missing.
+func LoadProject(paths []string, envFile string) (*Project, error) {
+	p := &Project{}
+	for _, path := range paths {
+		d, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		p.Documents = append(p.Documents, d)
+	}
+	if envFile == "" {
+		envFile = filepath.Join(filepath.Dir(paths[0]), EnvFileName)
+	} else if _, err := os.Stat(envFile); os.IsNotExist(err) {
+		return nil, fmt.Errorf("env file %s doesn't exist", envFile)
+	}
+	env, err := LoadEnvFile(envFile)
+	if err != nil {
+		return nil, err
+	}
+	p.Env = env
+	return p, nil
+}
+
+// ServiceNames returns the names of all services defined in any of the files,
+// in the order they appear first
+func (p *Project) ServiceNames() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, d := range p.Documents {
+		for _, s := range d.Services() {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				names = append(names, s.Name)
+			}
+		}
+	}
+	return names
+}
+
+// Definitions returns the definitions of the service in all files which
+// contain it, in file order
+func (p *Project) Definitions(name string) ([]*Service, error) {
+	defs := []*Service{}
+	for _, d := range p.Documents {
+		if s, err := d.Service(name); err == nil {
+			defs = append(defs, s)
+		}
+	}
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+	return defs, nil
+}
+
+// Owner returns the definition of the service which is responsible for key.
+// That is the last file defining key, either active or commented out. If no
+// file mentions key, the last definition of the service is returned.
+func (p *Project) Owner(name, key string) (*Service, error) {
+	defs, err := p.Definitions(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(defs) - 1; i >= 0; i-- {
+		if defs[i].Node.Child(key) != nil || defs[i].Node.CommentedChild(key) != nil {
+			return defs[i], nil
+		}
+	}
+	return defs[len(defs)-1], nil
+}
+
+// Effective returns the node of key which is in effect after merging all
+// files. Commented out nodes are only returned if no file has an active one.
+func (p *Project) Effective(name, key string) (*Node, error) {
+	defs, err := p.Definitions(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(defs) - 1; i >= 0; i-- {
+		if n := defs[i].Node.Child(key); n != nil {
+			return n, nil
+		}
+	}
+	for i := len(defs) - 1; i >= 0; i-- {
+		if n := defs[i].Node.CommentedChild(key); n != nil {
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// Changed returns all documents which were modified since they were loaded
+func (p *Project) Changed() []*Document {
+	changed := []*Document{}
+	for _, d := range p.Documents {
+		if d.Changed() {
+			changed = append(changed, d)
+		}
+	}
+	return changed
+}
+
+// Info returns the merged view of the service
+func (p *Project) Info(name string) (*Info, error) {
+	defs, err := p.Definitions(name)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Name: name}
+	image, _ := p.Effective(name, "image")
+	build, _ := p.Effective(name, "build")
+	switch {
+	case build != nil && !build.Commented:
+		info.Mode = ModeBuild
+	case image != nil && !image.Commented:
+		info.Mode = ModeImage
+	}
+	for _, n := range []*Node{image, build} {
+		if n != nil && strings.HasPrefix(n.Value, "*") {
+			return nil, fmt.Errorf("service %s: %s is the alias %s, anchors aren't supported", name, n.Key, n.Value)
+		}
+	}
+	if image != nil {
+		if info.Image, err = p.resolveNode(image); err != nil {
+			return nil, fmt.Errorf("service %s: %s", name, err)
+		}
+		info.Tag = ParseReference(info.Image).Tag
+	}
+	if build != nil {
+		b, err := ParseBuild(build)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %s", name, err)
+		}
+		for _, v := range []*string{&b.Context, &b.Dockerfile, &b.Target} {
+			if *v, err = p.resolveValue(*v, build.Commented); err != nil {
+				return nil, fmt.Errorf("service %s: %s", name, err)
+			}
+		}
+		info.Build, info.Dockerfile, info.Target = b.Context, b.Dockerfile, b.Target
+		_, info.Remote = ParseGitContext(b.Context)
+	}
+	info.File = defs[len(defs)-1].Doc.Path
+	return info, nil
+}
+
+// Infos returns the merged view of all services which can be read and the
+// errors of the ones which can't
+func (p *Project) Infos() ([]*Info, []error) {
+	infos := []*Info{}
+	errs := []error{}
+	for _, name := range p.ServiceNames() {
+		info, err := p.Info(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, errs
+}
+
+// resolveNode interpolates the value of n
+func (p *Project) resolveNode(n *Node) (string, error) {
+	return p.resolveValue(n.Value, n.Commented)
+}
+
+// resolveValue interpolates s. Commented out values are only informational,
+// if they can't be resolved they are returned as they are.
+func (p *Project) resolveValue(s string, commented bool) (string, error) {
+	v, err := p.Resolve(s)
+	if err != nil && commented {
+		return s, nil
+	}
+	return v, err
+}
@@ -0,0 +1,71 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInfos(t *testing.T) {
+	d := Parse([]byte("services:\n  api:\n    image: *img\n  web:\n    image: web:1\n"))
+	d.Path = "/project/docker-compose.yml"
+	infos, errs := (&Project{Documents: []*Document{d}}).Infos()
+	if len(infos) != 1 || infos[0].Name != "web" {
+		t.Errorf("got infos %+v, want web only", infos)
+	}
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, want one for api", errs)
+	}
+}
+
+func TestLoadProjectEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	compose := filepath.Join(dir, "docker-compose.yml")
+	if err := ioutil.WriteFile(compose, []byte("services:\n  api:\n    image: api:${TAG}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the default .env may be missing
+	if _, err := LoadProject([]string{compose}, ""); err != nil {
+		t.Errorf("missing default env file: %s", err)
+	}
+	if _, err := LoadProject([]string{compose}, filepath.Join(dir, "prod.env")); err == nil {
+		t.Error("expected an error for a missing env file given explicitly")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "prod.env"), []byte("TAG=2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadProject([]string{compose}, filepath.Join(dir, "prod.env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := p.Info("api"); err != nil || info.Image != "api:2" {
+		t.Errorf("got %+v, %v, want image api:2", info, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import "strings"
+
+// DefaultRegistry is used for images without a registry host
+const DefaultRegistry = "docker.io"
+
+// Reference is a parsed image reference like registry:5000/team/api:1.2@sha256:...
+type Reference struct {
+	// Registry is the host with an optional port, empty if the image has none
+	Registry string
+	// Path is the repository path including the namespace
+	Path   string
+	Tag    string
+	Digest string
+}
+
+// ParseReference splits an image reference into its parts. The first path
+// component is a registry if it contains a dot or a port or is localhost,
+// the same rule docker itself uses.
+func ParseReference(s string) Reference {
+	r := Reference{}
+	// separators inside variables like ${API_TAG:-1.2} don't count
+	m := maskVariables(s)
+	if i := strings.Index(m, "@"); i >= 0 {
+		r.Digest = s[i+1:]
+		s, m = s[:i], m[:i]
+	}
+	if i := strings.LastIndex(m, ":"); i >= 0 && !strings.Contains(m[i:], "/") {
+		r.Tag = s[i+1:]
+		s, m = s[:i], m[:i]
+	}
+	if i := strings.Index(m, "/"); i >= 0 {
+		host := s[:i]
+		if strings.ContainsAny(m[:i], ".:") || host == "localhost" {
+			r.Registry = host
+			s = s[i+1:]
+		}
+	}
+	r.Path = s
+	return r
+}
+
+// maskVariables replaces everything inside ${...} with underscores, keeping
+// the positions of all other characters
+func maskVariables(s string) string {
+	b := []byte(s)
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '$' && i+1 < len(b) && b[i+1] == '{':
+			depth++
+			i++
+		case b[i] == '}' && depth > 0:
+			depth--
+		case depth > 0:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// Name returns the reference without tag and digest, as it was written
+func (r Reference) Name() string {
+	if r.Registry == "" {
+		return r.Path
+	}
+	return r.Registry + "/" + r.Path
+}
+
+// String returns the full reference
+func (r Reference) String() string {
+	s := r.Name()
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Domain returns the registry the image is pulled from
+func (r Reference) Domain() string {
+	if r.Registry == "" {
+		return DefaultRegistry
+	}
+	return r.Registry
+}
+
+// Repository returns the path of the image in its registry, official images
+// of the default registry live in the library namespace
+func (r Reference) Repository() string {
+	if r.Domain() == DefaultRegistry && !strings.Contains(r.Path, "/") {
+		return "library/" + r.Path
+	}
+	return r.Path
+}
@@ -0,0 +1,69 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	const digest = "sha256:4bcdffd70da292293d059d2435c7056711fab2655f8b74f48ad0abe042b63687"
+	tests := []struct {
+		in         string
+		want       Reference
+		domain     string
+		repository string
+	}{
+		{"postgres", Reference{Path: "postgres"}, "docker.io", "library/postgres"},
+		{"postgres:9.6", Reference{Path: "postgres", Tag: "9.6"}, "docker.io", "library/postgres"},
+		{"team/api:1.2", Reference{Path: "team/api", Tag: "1.2"}, "docker.io", "team/api"},
+		{"registry.local:5000/team/api:1.2", Reference{Registry: "registry.local:5000", Path: "team/api", Tag: "1.2"}, "registry.local:5000", "team/api"},
+		{"registry.local:5000/team/api", Reference{Registry: "registry.local:5000", Path: "team/api"}, "registry.local:5000", "team/api"},
+		{"gcr.io/org/team/sub/api:2", Reference{Registry: "gcr.io", Path: "org/team/sub/api", Tag: "2"}, "gcr.io", "org/team/sub/api"},
+		{"org/team/api", Reference{Path: "org/team/api"}, "docker.io", "org/team/api"},
+		{"localhost/api:1", Reference{Registry: "localhost", Path: "api", Tag: "1"}, "localhost", "api"},
+		{"localhost:5000/api", Reference{Registry: "localhost:5000", Path: "api"}, "localhost:5000", "api"},
+		{"localdev/api:1", Reference{Path: "localdev/api", Tag: "1"}, "docker.io", "localdev/api"},
+		{"team/api:1.2@" + digest, Reference{Path: "team/api", Tag: "1.2", Digest: digest}, "docker.io", "team/api"},
+		{"team/api@" + digest, Reference{Path: "team/api", Digest: digest}, "docker.io", "team/api"},
+		{"registry.local:5000/api@" + digest, Reference{Registry: "registry.local:5000", Path: "api", Digest: digest}, "registry.local:5000", "api"},
+		{"team/api:${API_TAG}", Reference{Path: "team/api", Tag: "${API_TAG}"}, "docker.io", "team/api"},
+		{"team/api:${API_TAG:-1.2}", Reference{Path: "team/api", Tag: "${API_TAG:-1.2}"}, "docker.io", "team/api"},
+		{"registry.local:5000/api:${TAG:-a/b}", Reference{Registry: "registry.local:5000", Path: "api", Tag: "${TAG:-a/b}"}, "registry.local:5000", "api"},
+		{"${REGISTRY}/team/api:1", Reference{Path: "${REGISTRY}/team/api", Tag: "1"}, "docker.io", "${REGISTRY}/team/api"},
+		// a registry in a variable is only known once it is resolved
+		{"${REGISTRY:-registry.local:5000}/api", Reference{Path: "${REGISTRY:-registry.local:5000}/api"}, "docker.io", "${REGISTRY:-registry.local:5000}/api"},
+	}
+	for _, tc := range tests {
+		got := ParseReference(tc.in)
+		if got != tc.want {
+			t.Errorf("%s: got %#v, want %#v", tc.in, got, tc.want)
+			continue
+		}
+		if got.Domain() != tc.domain {
+			t.Errorf("%s: domain %s, want %s", tc.in, got.Domain(), tc.domain)
+		}
+		if got.Repository() != tc.repository {
+			t.Errorf("%s: repository %s, want %s", tc.in, got.Repository(), tc.repository)
+		}
+		if s := got.String(); s != tc.in {
+			t.Errorf("%s: String() returned %s", tc.in, s)
+		}
+	}
+}
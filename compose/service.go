@@ -0,0 +1,126 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package compose
+
+import (
+	"fmt"
+	"strings"
+)
+
+// topLevelKeys are the keys of version 2 and 3 files besides services
+var topLevelKeys = map[string]bool{
+	"version":  true,
+	"services": true,
+	"networks": true,
+	"volumes":  true,
+	"secrets":  true,
+	"configs":  true,
+	"name":     true,
+}
+
+// Modes a service can be in, depending on whether image or build is commented out
+const (
+	ModeImage = "image"
+	ModeBuild = "build"
+)
+
+// Info is the merged view of a service across all files of a project
+type Info struct {
+	Name string `json:"name" yaml:"name"`
+	// Mode is empty if neither image nor build is active
+	Mode  string `json:"mode" yaml:"mode"`
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+	Tag   string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	// Build is the context of the build definition
+	Build      string `json:"build,omitempty" yaml:"build,omitempty"`
+	Dockerfile string `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	Target     string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Remote is set for build contexts which are git urls
+	Remote bool `json:"remote,omitempty" yaml:"remote,omitempty"`
+	// File is the last compose file defining the service
+	File string `json:"file" yaml:"file"`
+}
+
+// Service is a single service definition of a document
+type Service struct {
+	Name string
+	Node *Node
+	Doc  *Document
+}
+
+// Services returns all services of the document in the order they are defined.
+// Files without a services key (version 1) are supported as well.
+func (d *Document) Services() []*Service {
+	parent := d.root.Child("services")
+	v1 := parent == nil
+	if v1 {
+		parent = d.root
+	}
+	services := []*Service{}
+	for _, n := range parent.Children {
+		if n.Commented || n.Item {
+			continue
+		}
+		if v1 && (topLevelKeys[n.Key] || strings.HasPrefix(n.Key, "x-")) {
+			continue
+		}
+		services = append(services, &Service{Name: n.Key, Node: n, Doc: d})
+	}
+	return services
+}
+
+// Service returns the service with the given name
+func (d *Document) Service(name string) (*Service, error) {
+	for _, s := range d.Services() {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("service %s not found", name)
+}
+
+// Images returns the image nodes of the service, the active one first
+// followed by commented out ones
+func (s *Service) Images() []*Node {
+	return s.nodes("image")
+}
+
+// Build returns the build node of the service. If build is commented out
+// the commented node is returned.
+func (s *Service) Build() *Node {
+	if n := s.Node.Child("build"); n != nil {
+		return n
+	}
+	return s.Node.CommentedChild("build")
+}
+
+func (s *Service) nodes(key string) []*Node {
+	nodes := []*Node{}
+	if n := s.Node.Child(key); n != nil {
+		nodes = append(nodes, n)
+	}
+	for _, c := range s.Node.Children {
+		if c.Commented && !c.Item && c.Key == key {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
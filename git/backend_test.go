@@ -0,0 +1,173 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testRepos creates a bare origin with the branches main and feature, a
+// clone of it and a plain folder in dir
+func testRepos(t *testing.T, dir string) (clone, plain string) {
+	git := func(folder string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = folder
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s: %s", args, err, out)
+		}
+	}
+	origin := filepath.Join(dir, "origin.git")
+	seed := filepath.Join(dir, "seed")
+	git(dir, "init", "-q", "--bare", origin)
+	git(origin, "symbolic-ref", "HEAD", "refs/heads/main")
+	git(dir, "init", "-q", seed)
+	git(seed, "checkout", "-q", "-b", "main")
+	if err := ioutil.WriteFile(filepath.Join(seed, "file"), []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git(seed, "add", "file")
+	git(seed, "commit", "-q", "-m", "first")
+	git(seed, "branch", "feature")
+	git(seed, "push", "-q", origin, "main", "feature")
+
+	clone = filepath.Join(dir, "clone")
+	git(dir, "clone", "-q", origin, clone)
+	if err := os.Mkdir(filepath.Join(clone, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plain = filepath.Join(dir, "plain")
+	if err := os.Mkdir(plain, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return clone, plain
+}
+
+// TestBackends runs the same cases against both backends, they have to
+// report the same results and errors
+func TestBackends(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	for _, name := range []string{"exec", "go-git"} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "cft")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			dir, _ = filepath.EvalSymlinks(dir)
+			clone, plain := testRepos(t, dir)
+			b, err := New(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := b.Root(plain); !errors.Is(err, ErrNotRepository) {
+				t.Errorf("Root of a plain folder: got %v, want ErrNotRepository", err)
+			}
+			if _, err := b.Status(plain); !errors.Is(err, ErrNotRepository) {
+				t.Errorf("Status of a plain folder: got %v, want ErrNotRepository", err)
+			}
+			if root, err := b.Root(filepath.Join(clone, "sub")); err != nil || root != clone {
+				t.Errorf("Root of a sub folder: got %s, %v, want %s", root, err, clone)
+			}
+
+			// a broken repository is an error, but not a missing one
+			broken := filepath.Join(dir, "broken")
+			if err := os.MkdirAll(broken, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(broken, ".git"), []byte("gitdir: "+filepath.Join(dir, "missing")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := b.Status(broken); err == nil || errors.Is(err, ErrNotRepository) {
+				t.Errorf("Status of a broken repository: got %v, want another error than ErrNotRepository", err)
+			}
+
+			st, err := b.Status(clone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Branch != "main" || st.Head == "" || st.Changes != 0 || st.Untracked != 0 || st.Operation != "" {
+				t.Errorf("Status of the clone: got %+v", st)
+			}
+
+			if err := b.HasBranch(clone, "origin", "feature"); err != nil {
+				t.Errorf("HasBranch feature: %v", err)
+			}
+			if err := b.HasBranch(clone, "origin", "missing"); !errors.Is(err, ErrBranchNotFound) {
+				t.Errorf("HasBranch missing: got %v, want ErrBranchNotFound", err)
+			}
+			if err := b.HasBranch(clone, "upstream", "feature"); !errors.Is(err, ErrRemoteNotFound) {
+				t.Errorf("HasBranch on a missing remote: got %v, want ErrRemoteNotFound", err)
+			}
+			if err := b.Fetch(clone, "upstream"); !errors.Is(err, ErrRemoteNotFound) {
+				t.Errorf("Fetch of a missing remote: got %v, want ErrRemoteNotFound", err)
+			}
+			if def, err := b.DefaultBranch(clone, "origin"); err != nil || def != "main" {
+				t.Errorf("DefaultBranch: got %s, %v, want main", def, err)
+			}
+			if _, err := b.DefaultBranch(clone, "upstream"); !errors.Is(err, ErrRemoteNotFound) {
+				t.Errorf("DefaultBranch of a missing remote: got %v, want ErrRemoteNotFound", err)
+			}
+			if err := b.Fetch(clone, "origin"); err != nil {
+				t.Errorf("Fetch: %v", err)
+			}
+			if !b.RefExists(clone, "origin/feature") || b.RefExists(clone, "origin/missing") {
+				t.Error("RefExists doesn't match the branches of origin")
+			}
+
+			if _, err := b.CreateBranch(clone, "feature", "origin/feature", true); err != nil {
+				t.Fatal(err)
+			}
+			if up, err := b.Upstream(clone, "feature"); err != nil || up != "origin/feature" {
+				t.Errorf("Upstream of a tracking branch: got %s, %v, want origin/feature", up, err)
+			}
+			if _, err := b.CreateBranch(clone, "topic", "origin/main", false); err != nil {
+				t.Fatal(err)
+			}
+			if up, err := b.Upstream(clone, "topic"); err != nil || up != "" {
+				t.Errorf("Upstream of a branch created without tracking: got %s, %v, want none", up, err)
+			}
+			if st, err := b.Status(clone); err != nil || st.Branch != "topic" {
+				t.Errorf("Status after CreateBranch: got %+v, %v, want branch topic", st, err)
+			}
+			if ahead, behind, err := b.AheadBehind(clone, "topic", "origin/main"); err != nil || ahead != 0 || behind != 0 {
+				t.Errorf("AheadBehind: got %d, %d, %v", ahead, behind, err)
+			}
+			if _, err := b.Checkout(clone, "main"); err != nil {
+				t.Errorf("Checkout: %v", err)
+			}
+			if c, err := b.LastCommit(clone); err != nil || c.Subject != "first" || c.Author != "test" {
+				t.Errorf("LastCommit: got %+v, %v", c, err)
+			}
+		})
+	}
+}
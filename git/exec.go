@@ -0,0 +1,302 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// unmergedCodes are the git status codes of files with conflicts
+var unmergedCodes = []string{"DD", "AU", "UD", "UA", "DU", "AA", "UU"}
+
+// Exec runs the git binary found in the PATH
+type Exec struct{}
+
+// ExitError is returned if git fails. Err is one of the Err* values if the
+// failure is known, errors.Is finds it.
+type ExitError struct {
+	Args   []string
+	Code   int
+	Stderr string
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("git %s: exit status %d", strings.Join(e.Args, " "), e.Code)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// Root returns the top level folder of the repository
+func (e *Exec) Root(folder string) (string, error) {
+	if _, err := findDotGit(folder); err != nil {
+		return "", err
+	}
+	return e.run(folder, "rev-parse", "--show-toplevel")
+}
+
+// Status returns the state of the worktree
+func (e *Exec) Status(folder string) (*Status, error) {
+	if _, err := findDotGit(folder); err != nil {
+		return nil, err
+	}
+	gitDir, err := e.run(folder, "rev-parse", "--git-dir")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(folder, gitDir)
+	}
+	st := &Status{Operation: operation(gitDir)}
+
+	out, err := e.run(folder, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case len(line) < 2:
+		case line[:2] == "??":
+			st.Untracked++
+		case contains(unmergedCodes, line[:2]):
+			st.Conflicts++
+		default:
+			st.Changes++
+		}
+	}
+	// symbolic-ref fails with exit status 1 if the HEAD is detached
+	st.Branch, _ = e.run(folder, "symbolic-ref", "-q", "--short", "HEAD")
+	// a branch without commits has no HEAD yet
+	st.Head, _ = e.run(folder, "rev-parse", "--short", "HEAD")
+	return st, nil
+}
+
+// Remotes returns the names of all remotes
+func (e *Exec) Remotes(folder string) ([]string, error) {
+	out, err := e.run(folder, "remote")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// HasBranch checks if branch exists on remote, ls-remote exits with status
+// 2 if it doesn't
+func (e *Exec) HasBranch(folder, remote, branch string) error {
+	if err := e.hasRemote(folder, remote); err != nil {
+		return err
+	}
+	_, err := e.run(folder, "ls-remote", "--heads", "--exit-code", remote, "refs/heads/"+branch)
+	if exit, ok := err.(*ExitError); ok && exit.Code == 2 {
+		exit.Err = fmt.Errorf("%s on %s: %w", branch, remote, ErrBranchNotFound)
+	}
+	return err
+}
+
+// DefaultBranch returns the branch the HEAD of remote points to.
+// <remote>/HEAD is only set by clone, without it the remote is asked.
+func (e *Exec) DefaultBranch(folder, remote string) (string, error) {
+	if err := e.hasRemote(folder, remote); err != nil {
+		return "", err
+	}
+	if out, err := e.run(folder, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD"); err == nil {
+		return strings.TrimPrefix(out, remote+"/"), nil
+	}
+	out, err := e.run(folder, "ls-remote", "--symref", remote, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "ref: refs/heads/") {
+			return strings.Fields(strings.TrimPrefix(line, "ref: refs/heads/"))[0], nil
+		}
+	}
+	return "", fmt.Errorf("HEAD of %s: %w", remote, ErrBranchNotFound)
+}
+
+// RefExists checks if ref can be resolved to a commit
+func (e *Exec) RefExists(folder, ref string) bool {
+	_, err := e.run(folder, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// Fetch fetches remote
+func (e *Exec) Fetch(folder, remote string) error {
+	if err := e.hasRemote(folder, remote); err != nil {
+		return err
+	}
+	_, err := e.run(folder, "fetch", remote)
+	return err
+}
+
+// Checkout checks out an existing branch or commit
+func (e *Exec) Checkout(folder, ref string) (string, error) {
+	return e.runOutput(folder, "checkout", ref)
+}
+
+// CreateBranch creates or resets branch to start and checks it out
+func (e *Exec) CreateBranch(folder, branch, start string, track bool) (string, error) {
+	// without --no-track git's branch.autoSetupMerge would track start
+	// if it is a remote branch
+	args := []string{"checkout", "-B", branch, "--no-track"}
+	if track {
+		args = []string{"checkout", "-B", branch, "--track"}
+	}
+	return e.runOutput(folder, append(args, start)...)
+}
+
+// Stash stashes the local changes. Whether there were any is told by
+// refs/stash changing, the output of git depends on its version and locale.
+func (e *Exec) Stash(folder, message string, untracked bool) (bool, error) {
+	before, _ := e.run(folder, "rev-parse", "--quiet", "--verify", "refs/stash")
+	args := []string{"stash", "push", "-m", message}
+	if untracked {
+		args = append(args, "--include-untracked")
+	}
+	if _, err := e.run(folder, args...); err != nil {
+		return false, err
+	}
+	after, _ := e.run(folder, "rev-parse", "--quiet", "--verify", "refs/stash")
+	return after != before, nil
+}
+
+// Stashes returns all stashes, the newest first
+func (e *Exec) Stashes(folder string) ([]Stash, error) {
+	if _, err := e.Root(folder); err != nil {
+		return nil, err
+	}
+	out, err := e.run(folder, "stash", "list", "--format=%gd%x00%ci%x00%gs")
+	if err != nil {
+		return nil, err
+	}
+	stashes := []Stash{}
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "\x00", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		t, _ := time.Parse("2006-01-02 15:04:05 -0700", parts[1])
+		stashes = append(stashes, Stash{Ref: parts[0], Time: t, Message: stashMessage(parts[2])})
+	}
+	return stashes, nil
+}
+
+// PopStash applies and drops the stash ref
+func (e *Exec) PopStash(folder, ref string) error {
+	_, err := e.run(folder, "stash", "pop", ref)
+	return err
+}
+
+// Upstream returns the branch branch tracks
+func (e *Exec) Upstream(folder, branch string) (string, error) {
+	return e.run(folder, "for-each-ref", "--format=%(upstream:short)", "refs/heads/"+branch)
+}
+
+// AheadBehind counts the commits only reachable from ref and the ones only
+// reachable from upstream
+func (e *Exec) AheadBehind(folder, ref, upstream string) (int, int, error) {
+	out, err := e.run(folder, "rev-list", "--left-right", "--count", ref+"..."+upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ahead, behind int
+	if _, err := fmt.Sscan(out, &ahead, &behind); err != nil {
+		return 0, 0, fmt.Errorf("unexpected output of git rev-list: %s", out)
+	}
+	return ahead, behind, nil
+}
+
+// LastCommit returns the commit checked out
+func (e *Exec) LastCommit(folder string) (*Commit, error) {
+	out, err := e.run(folder, "log", "-1", "--format=%h%x00%an%x00%ci%x00%s")
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(out, "\x00", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("unexpected output of git log: %s", out)
+	}
+	t, _ := time.Parse("2006-01-02 15:04:05 -0700", parts[2])
+	return &Commit{Hash: parts[0], Author: parts[1], Time: t, Subject: parts[3]}, nil
+}
+
+// hasRemote returns an ErrRemoteNotFound error if remote isn't configured,
+// git would take it for a url otherwise
+func (e *Exec) hasRemote(folder, remote string) error {
+	existing, err := e.Remotes(folder)
+	if err != nil {
+		return err
+	}
+	if !contains(existing, remote) {
+		return fmt.Errorf("%s: %w", remote, ErrRemoteNotFound)
+	}
+	return nil
+}
+
+// run runs git in folder and returns its trimmed standard output
+func (e *Exec) run(folder string, args ...string) (string, error) {
+	stdout, _, err := e.exec(folder, args...)
+	return strings.TrimSpace(stdout), err
+}
+
+// runOutput runs git in folder and returns everything it printed
+func (e *Exec) runOutput(folder string, args ...string) (string, error) {
+	stdout, stderr, err := e.exec(folder, args...)
+	return strings.TrimSpace(stdout + stderr), err
+}
+
+func (e *Exec) exec(folder string, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = folder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		err = &ExitError{Args: args, Code: exit.ExitCode(), Stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package git provides the git operations cft needs on the repositories of
+// the services. They are implemented by calling the git binary or in
+// process with go-git.
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Errors returned by the backends, they are wrapped together with details
+// and can be checked with errors.Is
+var (
+	ErrNotRepository  = errors.New("not a git repository")
+	ErrRemoteNotFound = errors.New("remote not found")
+	ErrBranchNotFound = errors.New("branch not found")
+	ErrUnsupported    = errors.New("not supported by this git backend")
+)
+
+// Operations which can be in progress in a repository
+const (
+	OpRebase     = "rebase"
+	OpMerge      = "merge"
+	OpCherryPick = "cherry-pick"
+	OpRevert     = "revert"
+)
+
+// Backend runs git operations on the repository folder belongs to
+type Backend interface {
+	// Root returns the top level folder of the repository
+	Root(folder string) (string, error)
+	// Status returns the state of the worktree
+	Status(folder string) (*Status, error)
+	// Remotes returns the names of all remotes
+	Remotes(folder string) ([]string, error)
+	// HasBranch checks if branch exists on remote, it returns an
+	// ErrBranchNotFound error if it doesn't
+	HasBranch(folder, remote, branch string) error
+	// DefaultBranch returns the branch the HEAD of remote points to
+	DefaultBranch(folder, remote string) (string, error)
+	// RefExists checks if ref can be resolved locally
+	RefExists(folder, ref string) bool
+	Fetch(folder, remote string) error
+	// Checkout checks out an existing branch or commit
+	Checkout(folder, ref string) (string, error)
+	// CreateBranch creates or resets branch to start and checks it out, with
+	// track start is set as its upstream
+	CreateBranch(folder, branch, start string, track bool) (string, error)
+	// Stash stashes the local changes with the given message and reports
+	// whether there were any
+	Stash(folder, message string, untracked bool) (bool, error)
+	// Stashes returns all stashes, the newest first
+	Stashes(folder string) ([]Stash, error)
+	// PopStash applies and drops the stash ref, like stash@{1}
+	PopStash(folder, ref string) error
+	// Upstream returns the branch branch tracks, like origin/main, or an
+	// empty string if it doesn't track any
+	Upstream(folder, branch string) (string, error)
+	// AheadBehind counts the commits only reachable from ref and the ones
+	// only reachable from upstream
+	AheadBehind(folder, ref, upstream string) (int, int, error)
+	// LastCommit returns the commit checked out
+	LastCommit(folder string) (*Commit, error)
+}
+
+// Status is the state of a worktree
+type Status struct {
+	// Branch is empty if the HEAD is detached
+	Branch string
+	// Head is the abbreviated commit checked out
+	Head string
+	// Operation is the rebase, merge, cherry-pick or revert in progress
+	Operation string
+	// Conflicts, Changes and Untracked count the files with conflicts,
+	// changed tracked files and untracked files
+	Conflicts int
+	Changes   int
+	Untracked int
+}
+
+// Stash is a single stash of a repository
+type Stash struct {
+	Ref     string
+	Time    time.Time
+	Message string
+}
+
+// Commit is a single commit, Hash is abbreviated
+type Commit struct {
+	Hash    string    `json:"hash" yaml:"hash"`
+	Author  string    `json:"author" yaml:"author"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Subject string    `json:"subject" yaml:"subject"`
+}
+
+// Backend names
+const (
+	BackendExec  = "exec"
+	BackendGoGit = "go-git"
+)
+
+// New returns the backend with the given name
+func New(name string) (Backend, error) {
+	switch name {
+	case BackendExec, "":
+		return &Exec{}, nil
+	case BackendGoGit:
+		return &GoGit{}, nil
+	}
+	return nil, fmt.Errorf("unknown git backend %s, use %s or %s", name, BackendExec, BackendGoGit)
+}
+
+// findDotGit returns the .git folder or file of the repository folder belongs
+// to, the parent folders are searched like git does. An ErrNotRepository
+// error is returned if there is none.
+func findDotGit(folder string) (string, error) {
+	dir, err := filepath.Abs(folder)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if _, err := os.Stat(dotGit); err == nil {
+			return dotGit, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s: %w", folder, ErrNotRepository)
+		}
+		dir = parent
+	}
+}
+
+// operation returns the operation in progress in the repository with the
+// given git directory
+func operation(gitDir string) string {
+	files := []struct{ name, op string }{
+		{"rebase-merge", OpRebase},
+		{"rebase-apply", OpRebase},
+		{"MERGE_HEAD", OpMerge},
+		{"CHERRY_PICK_HEAD", OpCherryPick},
+		{"REVERT_HEAD", OpRevert},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(gitDir, f.name)); err == nil {
+			return f.op
+		}
+	}
+	return ""
+}
+
+// stashMessage strips the "On <branch>: " prefix git adds to the message
+// of a stash
+func stashMessage(subject string) string {
+	if i := strings.Index(subject, ": "); i >= 0 {
+		return subject[i+2:]
+	}
+	return subject
+}
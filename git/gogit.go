@@ -0,0 +1,461 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// GoGit works on the repositories in process, no git binary is needed.
+// go-git can't stash, local changes have to be committed or skipped.
+type GoGit struct{}
+
+// Root returns the top level folder of the repository
+func (g *GoGit) Root(folder string) (string, error) {
+	wt, err := g.worktree(folder)
+	if err != nil {
+		return "", err
+	}
+	return wt.Filesystem.Root(), nil
+}
+
+// Status returns the state of the worktree
+func (g *GoGit) Status(folder string) (*Status, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	st := &Status{}
+	if fs, ok := r.Storer.(*filesystem.Storage); ok {
+		st.Operation = operation(fs.Filesystem().Root())
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	files, err := wt.Status()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		switch {
+		case f.Worktree == gogit.Untracked:
+			st.Untracked++
+		case f.Staging == gogit.UpdatedButUnmerged || f.Worktree == gogit.UpdatedButUnmerged:
+			st.Conflicts++
+		case f.Staging != gogit.Unmodified || f.Worktree != gogit.Unmodified:
+			st.Changes++
+		}
+	}
+
+	head, err := r.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		// a branch without commits
+		if ref, err := r.Storer.Reference(plumbing.HEAD); err == nil && ref.Type() == plumbing.SymbolicReference {
+			st.Branch = ref.Target().Short()
+		}
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if head.Name().IsBranch() {
+		st.Branch = head.Name().Short()
+	}
+	st.Head = head.Hash().String()[:7]
+	return st, nil
+}
+
+// Remotes returns the names of all remotes
+func (g *GoGit) Remotes(folder string) ([]string, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	list, err := r.Remotes()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, rm := range list {
+		names = append(names, rm.Config().Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// HasBranch checks if branch exists on remote
+func (g *GoGit) HasBranch(folder, remote, branch string) error {
+	refs, err := g.list(folder, remote)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.NewBranchReferenceName(branch) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s on %s: %w", branch, remote, ErrBranchNotFound)
+}
+
+// DefaultBranch returns the branch the HEAD of remote points to.
+// <remote>/HEAD is only set by clone, without it the remote is asked.
+func (g *GoGit) DefaultBranch(folder, remote string) (string, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return "", err
+	}
+	if ref, err := r.Storer.Reference(plumbing.NewRemoteHEADReferenceName(remote)); err == nil && ref.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(ref.Target().Short(), remote+"/"), nil
+	}
+	refs, err := g.list(folder, remote)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference && ref.Target().IsBranch() {
+			return ref.Target().Short(), nil
+		}
+	}
+	return "", fmt.Errorf("HEAD of %s: %w", remote, ErrBranchNotFound)
+}
+
+// RefExists checks if ref can be resolved to a commit
+func (g *GoGit) RefExists(folder, ref string) bool {
+	r, err := g.open(folder)
+	if err != nil {
+		return false
+	}
+	_, err = r.ResolveRevision(plumbing.Revision(ref))
+	return err == nil
+}
+
+// Fetch fetches remote
+func (g *GoGit) Fetch(folder, remote string) error {
+	r, err := g.open(folder)
+	if err != nil {
+		return err
+	}
+	err = r.Fetch(&gogit.FetchOptions{RemoteName: remote})
+	if err == gogit.ErrRemoteNotFound {
+		return fmt.Errorf("%s: %w", remote, ErrRemoteNotFound)
+	}
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+// Checkout checks out an existing branch or commit
+func (g *GoGit) Checkout(folder, ref string) (string, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return "", err
+	}
+	opts := &gogit.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(ref)}
+	if _, err := r.Storer.Reference(opts.Branch); err != nil {
+		hash, err := r.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		opts = &gogit.CheckoutOptions{Hash: *hash}
+	}
+	if err := g.checkout(r, opts); err != nil {
+		return "", err
+	}
+	return "Switched to " + ref, nil
+}
+
+// CreateBranch creates or resets branch to start and checks it out, with
+// track start has to be a remote branch like origin/develop
+func (g *GoGit) CreateBranch(folder, branch, start string, track bool) (string, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return "", err
+	}
+	if err := g.clean(r); err != nil {
+		return "", err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(start))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", start, err)
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	if err := r.Storer.SetReference(plumbing.NewHashReference(name, *hash)); err != nil {
+		return "", err
+	}
+	if track {
+		parts := strings.SplitN(start, "/", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("%s isn't a remote branch, can't track it", start)
+		}
+		cfg, err := r.Config()
+		if err != nil {
+			return "", err
+		}
+		cfg.Branches[branch] = &config.Branch{Name: branch, Remote: parts[0], Merge: plumbing.NewBranchReferenceName(parts[1])}
+		if err := r.SetConfig(cfg); err != nil {
+			return "", err
+		}
+	}
+	if err := g.checkout(r, &gogit.CheckoutOptions{Branch: name}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Switched to branch %s at %s", branch, start), nil
+}
+
+// Stash only succeeds if there is nothing to stash
+func (g *GoGit) Stash(folder, message string, untracked bool) (bool, error) {
+	st, err := g.Status(folder)
+	if err != nil {
+		return false, err
+	}
+	if st.Changes > 0 || st.Conflicts > 0 || (untracked && st.Untracked > 0) {
+		return false, fmt.Errorf("stashing local changes: %w", ErrUnsupported)
+	}
+	return false, nil
+}
+
+// Stashes returns all stashes, the newest first. They are read from the
+// reflog of refs/stash, its lines look like
+// <old> <new> <name> <<email>> <unix time> <zone>\t<subject>
+func (g *GoGit) Stashes(folder string) ([]Stash, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	fs, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, fmt.Errorf("listing stashes: %w", ErrUnsupported)
+	}
+	f, err := os.Open(filepath.Join(fs.Filesystem().Root(), "logs", "refs", "stash"))
+	if os.IsNotExist(err) {
+		return []Stash{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stashes := []Stash{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), "\t", 2)
+		fields := strings.Fields(parts[0])
+		if len(parts) != 2 || len(fields) < 2 {
+			continue
+		}
+		stashes = append([]Stash{{Time: reflogTime(fields[len(fields)-2:]), Message: stashMessage(parts[1])}}, stashes...)
+	}
+	for i := range stashes {
+		stashes[i].Ref = fmt.Sprintf("stash@{%d}", i)
+	}
+	return stashes, scanner.Err()
+}
+
+// PopStash isn't supported by go-git
+func (g *GoGit) PopStash(folder, ref string) error {
+	return fmt.Errorf("restoring %s: %w", ref, ErrUnsupported)
+}
+
+// Upstream returns the branch branch tracks
+func (g *GoGit) Upstream(folder, branch string) (string, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	b, ok := cfg.Branches[branch]
+	if !ok || b.Merge == "" {
+		return "", nil
+	}
+	// "." tracks a local branch
+	if b.Remote == "" || b.Remote == "." {
+		return b.Merge.Short(), nil
+	}
+	return b.Remote + "/" + b.Merge.Short(), nil
+}
+
+// AheadBehind counts the commits only reachable from ref and the ones only
+// reachable from upstream
+func (g *GoGit) AheadBehind(folder, ref, upstream string) (int, int, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return 0, 0, err
+	}
+	local, err := ancestors(r, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	remote, err := ancestors(r, upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for h := range local {
+		if !remote[h] {
+			ahead++
+		}
+	}
+	for h := range remote {
+		if !local[h] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// LastCommit returns the commit checked out
+func (g *GoGit) LastCommit(folder string) (*Commit, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &Commit{
+		Hash:    c.Hash.String()[:7],
+		Author:  c.Author.Name,
+		Time:    c.Author.When,
+		Subject: strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+	}, nil
+}
+
+// open opens the repository folder belongs to. go-git reports a broken .git
+// as missing repository, so its existence is checked first.
+func (g *GoGit) open(folder string) (*gogit.Repository, error) {
+	if _, err := findDotGit(folder); err != nil {
+		return nil, err
+	}
+	r, err := gogit.PlainOpenWithOptions(folder, &gogit.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", folder, err)
+	}
+	return r, nil
+}
+
+func (g *GoGit) worktree(folder string) (*gogit.Worktree, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	return r.Worktree()
+}
+
+// list returns the references on remote
+func (g *GoGit) list(folder, remote string) ([]*plumbing.Reference, error) {
+	r, err := g.open(folder)
+	if err != nil {
+		return nil, err
+	}
+	rm, err := r.Remote(remote)
+	if err == gogit.ErrRemoteNotFound {
+		return nil, fmt.Errorf("%s: %w", remote, ErrRemoteNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rm.List(&gogit.ListOptions{})
+}
+
+// checkout refuses to work on a worktree with changes, go-git moves the
+// HEAD before it finds out the changes would be overwritten
+func (g *GoGit) checkout(r *gogit.Repository, opts *gogit.CheckoutOptions) error {
+	if err := g.clean(r); err != nil {
+		return err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return wt.Checkout(opts)
+}
+
+func (g *GoGit) clean(r *gogit.Repository) error {
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	files, err := wt.Status()
+	if err != nil {
+		return err
+	}
+	for path, f := range files {
+		if f.Worktree != gogit.Untracked && (f.Staging != gogit.Unmodified || f.Worktree != gogit.Unmodified) {
+			return errors.New("local changes in " + path + " would be overwritten")
+		}
+	}
+	return nil
+}
+
+// ancestors returns all commits reachable from ref
+func ancestors(r *gogit.Repository, ref string) (map[plumbing.Hash]bool, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, err)
+	}
+	commits, err := r.Log(&gogit.LogOptions{From: *hash})
+	if err != nil {
+		return nil, err
+	}
+	found := map[plumbing.Hash]bool{}
+	err = commits.ForEach(func(c *object.Commit) error {
+		found[c.Hash] = true
+		return nil
+	})
+	return found, err
+}
+
+// reflogTime parses the unix time and zone of a reflog entry
+func reflogTime(fields []string) time.Time {
+	sec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	t := time.Unix(sec, 0)
+	if zone, err := time.Parse("-0700", fields[1]); err == nil {
+		t = t.In(zone.Location())
+	}
+	return t
+}
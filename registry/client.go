@@ -0,0 +1,374 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package registry talks to docker registries via the Docker Registry HTTP API v2
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ackermannd/cft/compose"
+)
+
+// hubEndpoint serves the API of the default registry
+const hubEndpoint = "registry-1.docker.io"
+
+// manifestTypes are accepted when fetching manifests, lists are resolved
+// to a single platform
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// Client requests tags and manifests from registries
+type Client struct {
+	HTTP *http.Client
+	// Credentials returns user and password for a registry host, empty
+	// strings are returned for anonymous access
+	Credentials func(host string) (string, string)
+	// Insecure lists registries which are accessed via plain http,
+	// localhost and loopback addresses always are
+	Insecure []string
+
+	auth map[string]string
+}
+
+// NewClient returns a client using the credentials of the docker config
+func NewClient() *Client {
+	return &Client{HTTP: http.DefaultClient, Credentials: DockerCredentials}
+}
+
+// Tags returns all tags of the repository ref belongs to
+func (c *Client) Tags(ref compose.Reference) ([]string, error) {
+	next := c.endpoint(ref.Domain()) + "/v2/" + ref.Repository() + "/tags/list"
+	tags := []string{}
+	for next != "" {
+		resp, err := c.get(next, ref, nil)
+		if err != nil {
+			return nil, err
+		}
+		list := struct {
+			Tags []string `json:"tags"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, list.Tags...)
+		next = nextPage(resp)
+	}
+	return tags, nil
+}
+
+// Created returns the creation time of the image tag points to. For multi
+// platform images the linux/amd64 image, or the first one, is used.
+func (c *Client) Created(ref compose.Reference, tag string) (time.Time, error) {
+	m, err := c.manifest(ref, tag)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(m.Manifests) > 0 {
+		digest := m.Manifests[0].Digest
+		for _, p := range m.Manifests {
+			if p.Platform.OS == "linux" && p.Platform.Architecture == "amd64" {
+				digest = p.Digest
+				break
+			}
+		}
+		if m, err = c.manifest(ref, digest); err != nil {
+			return time.Time{}, err
+		}
+	}
+	if m.Config.Digest == "" {
+		return time.Time{}, fmt.Errorf("manifest of %s:%s has no config", ref.Name(), tag)
+	}
+
+	resp, err := c.get(c.endpoint(ref.Domain())+"/v2/"+ref.Repository()+"/blobs/"+m.Config.Digest, ref, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	config := struct {
+		Created time.Time `json:"created"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&config)
+	return config.Created, err
+}
+
+// Digest returns the content digest of the manifest tag points to, the
+// value to pin the image with
+func (c *Client) Digest(ref compose.Reference, tag string) (string, error) {
+	u := c.endpoint(ref.Domain()) + "/v2/" + ref.Repository() + "/manifests/" + tag
+	header := http.Header{"Accept": []string{strings.Join(manifestTypes, ", ")}}
+	resp, err := c.request("HEAD", u, ref, header)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if d := resp.Header.Get("Docker-Content-Digest"); d != "" {
+		return d, nil
+	}
+
+	// not every registry sends the digest, it is the hash of the manifest
+	if resp, err = c.get(u, ref, header); err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+type manifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func (c *Client) manifest(ref compose.Reference, reference string) (*manifest, error) {
+	header := http.Header{"Accept": []string{strings.Join(manifestTypes, ", ")}}
+	resp, err := c.get(c.endpoint(ref.Domain())+"/v2/"+ref.Repository()+"/manifests/"+reference, ref, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	m := &manifest{}
+	return m, json.NewDecoder(resp.Body).Decode(m)
+}
+
+// endpoint returns the base url of the registry API of host
+func (c *Client) endpoint(host string) string {
+	if host == compose.DefaultRegistry {
+		host = hubEndpoint
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	ip := net.ParseIP(hostname)
+	if hostname == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return "http://" + host
+	}
+	for _, i := range c.Insecure {
+		if i == host {
+			return "http://" + host
+		}
+	}
+	return "https://" + host
+}
+
+// get requests u and answers an authentication challenge of the registry
+func (c *Client) get(u string, ref compose.Reference, header http.Header) (*http.Response, error) {
+	return c.request("GET", u, ref, header)
+}
+
+func (c *Client) request(method, u string, ref compose.Reference, header http.Header) (*http.Response, error) {
+	key := ref.Domain() + "/" + ref.Repository()
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequest(method, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if auth, ok := c.auth[key]; ok {
+			req.Header.Set("Authorization", auth)
+		}
+		return c.HTTP.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		auth, err := c.authorize(challenge, ref)
+		if err != nil {
+			return nil, err
+		}
+		if c.auth == nil {
+			c.auth = map[string]string{}
+		}
+		c.auth[key] = auth
+		if resp, err = send(); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// authorize answers a Basic or Bearer challenge and returns the value of the
+// Authorization header to use
+func (c *Client) authorize(challenge string, ref compose.Reference) (string, error) {
+	user, password := "", ""
+	if c.Credentials != nil {
+		user, password = c.Credentials(ref.Domain())
+	}
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return "", fmt.Errorf("%s requires credentials, log in with docker login", ref.Domain())
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", fmt.Errorf("invalid auth challenge of %s: %s", ref.Domain(), challenge)
+		}
+		q := realm.Query()
+		if params["service"] != "" {
+			q.Set("service", params["service"])
+		}
+		scope := params["scope"]
+		if scope == "" {
+			scope = "repository:" + ref.Repository() + ":pull"
+		}
+		q.Set("scope", scope)
+		realm.RawQuery = q.Encode()
+
+		req, err := http.NewRequest("GET", realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("couldn't get token for %s: %s", ref.Name(), responseError(resp))
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+			return "", err
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", fmt.Errorf("unsupported auth challenge of %s: %s", ref.Domain(), challenge)
+}
+
+// parseChallenge splits a WWW-Authenticate header into scheme and parameters
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value = rest[1 : end+1]
+			rest = rest[end+1:]
+			rest = strings.TrimPrefix(rest, `"`)
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value = strings.TrimSpace(rest[:end])
+			rest = rest[end:]
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return parts[0], params
+}
+
+// nextPage returns the url of the next page of a paginated response
+func nextPage(resp *http.Response) string {
+	link := resp.Header.Get("Link")
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	next, err := resp.Request.URL.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
+
+// responseError turns the error response of a registry into an error
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	errs := struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	if json.Unmarshal(body, &errs) == nil && len(errs.Errors) > 0 {
+		return fmt.Errorf("%s: %s: %s", resp.Request.URL, errs.Errors[0].Code, errs.Errors[0].Message)
+	}
+	return fmt.Errorf("%s: %s", resp.Request.URL, resp.Status)
+}
@@ -0,0 +1,173 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ackermannd/cft/compose"
+)
+
+// testManifest is served for every tag by the test registry
+const testManifest = `{"schemaVersion":2,"config":{"digest":"sha256:c0ffee"}}`
+
+// testRegistry serves team/api with the given tags in pages of two. With
+// token set every request has to be authorized by a bearer token.
+func testRegistry(t *testing.T, tags []string, token bool, digestHeader bool) (*httptest.Server, compose.Reference) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, pw, _ := r.BasicAuth(); user != "user" || pw != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("service") != "test" || r.URL.Query().Get("scope") != "repository:team/api:pull" {
+				t.Errorf("unexpected token request %s", r.URL)
+			}
+			fmt.Fprint(w, `{"token":"t0k3n"}`)
+			return
+		}
+		if token && r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/v2/team/api/tags/list":
+			start := 0
+			if last := r.URL.Query().Get("last"); last != "" {
+				for i, tag := range tags {
+					if tag == last {
+						start = i + 1
+					}
+				}
+			}
+			end := start + 2
+			if end < len(tags) {
+				w.Header().Set("Link", `</v2/team/api/tags/list?n=2&last=`+tags[end-1]+`>; rel="next"`)
+			} else {
+				end = len(tags)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "team/api", "tags": tags[start:end]})
+		case strings.HasPrefix(r.URL.Path, "/v2/team/api/manifests/"):
+			if digestHeader {
+				w.Header().Set("Docker-Content-Digest", "sha256:fromheader")
+			}
+			if r.Method == "GET" {
+				fmt.Fprint(w, testManifest)
+			}
+		case r.URL.Path == "/v2/team/api/blobs/sha256:c0ffee":
+			fmt.Fprint(w, `{"created":"2016-05-01T10:00:00Z"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return srv, compose.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/team/api:1")
+}
+
+func testClient() *Client {
+	return &Client{HTTP: http.DefaultClient, Credentials: func(host string) (string, string) {
+		return "user", "secret"
+	}}
+}
+
+func TestTagsPagination(t *testing.T) {
+	tags := []string{"1.0", "1.1", "1.2", "2.0", "latest"}
+	srv, ref := testRegistry(t, tags, false, false)
+	defer srv.Close()
+
+	got, err := testClient().Tags(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("got %v, want %v", got, tags)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	tags := []string{"1.0", "1.1", "1.2"}
+	srv, ref := testRegistry(t, tags, true, false)
+	defer srv.Close()
+
+	got, err := testClient().Tags(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, tags) {
+		t.Errorf("got %v, want %v", got, tags)
+	}
+
+	anonymous := &Client{HTTP: http.DefaultClient}
+	if _, err := anonymous.Tags(ref); err == nil {
+		t.Error("expected an error without credentials")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	for _, header := range []bool{true, false} {
+		srv, ref := testRegistry(t, []string{"1.0"}, true, header)
+		want := "sha256:fromheader"
+		if !header {
+			want = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(testManifest)))
+		}
+		got, err := testClient().Digest(ref, "1.0")
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("header %v: got %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestCreated(t *testing.T) {
+	srv, ref := testRegistry(t, []string{"1.0"}, false, false)
+	defer srv.Close()
+
+	got, err := testClient().Created(ref, "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Format("2006-01-02 15:04") != "2016-05-01 10:00" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/mysql:pull"`)
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/mysql:pull",
+	}
+	if scheme != "Bearer" || !reflect.DeepEqual(params, want) {
+		t.Errorf("got %s %v", scheme, params)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2016 Daniel Ackermann <ackermann.d@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ackermannd/cft/compose"
+)
+
+// hubConfigKey is the key docker login uses for the default registry
+const hubConfigKey = "https://index.docker.io/v1/"
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerCredentials returns the credentials docker login stored for host,
+// either in ~/.docker/config.json (or $DOCKER_CONFIG) or in a credential helper
+func DockerCredentials(host string) (string, string) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return "", ""
+	}
+	config := dockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", ""
+	}
+
+	keys := []string{host, "https://" + host, "http://" + host}
+	if host == compose.DefaultRegistry {
+		keys = []string{hubConfigKey, "index.docker.io", hubEndpoint}
+	}
+
+	helper := config.CredsStore
+	if h, ok := config.CredHelpers[host]; ok {
+		helper = h
+	}
+	if helper != "" {
+		if user, secret := helperCredentials(helper, keys[0]); user != "" {
+			return user, secret
+		}
+	}
+
+	for _, k := range keys {
+		a, ok := config.Auths[k]
+		if !ok {
+			continue
+		}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if parts := strings.SplitN(string(decoded), ":", 2); err == nil && len(parts) == 2 {
+				return parts[0], parts[1]
+			}
+		}
+		if a.Username != "" {
+			return a.Username, a.Password
+		}
+	}
+	return "", ""
+}
+
+// helperCredentials asks the docker credential helper for the credentials of key
+func helperCredentials(helper, key string) (string, string) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(key)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", ""
+	}
+	creds := struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}{}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", ""
+	}
+	return creds.Username, creds.Secret
+}